@@ -0,0 +1,72 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/dewey/miniflux-sidekick/rules"
+)
+
+// runLint parses and checks killfiles from local paths or URLs and prints a report of all problems. It returns the
+// exit code: 0 if the killfiles are fine, 1 if there are problems and 2 if a killfile couldn't be read.
+func runLint(args []string, w io.Writer) int {
+	fs := flag.NewFlagSet("lint", flag.ContinueOnError)
+	fs.SetOutput(w)
+	fs.Usage = func() {
+		fmt.Fprintln(w, "usage: miniflux-sidekick lint <path-or-url> [<path-or-url>...]")
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	repo, err := rules.NewRepository(newHTTPClient(), false)
+	if err != nil {
+		fmt.Fprintln(w, err)
+		return 2
+	}
+	var problems int
+	for _, location := range fs.Args() {
+		parsedRules, err := repo.FetchRules(location)
+		diagnostics, ok := err.(rules.Diagnostics)
+		if err != nil && !ok {
+			fmt.Fprintf(w, "%s: %s\n", location, err)
+			return 2
+		}
+		diagnostics = append(diagnostics, rules.Lint(parsedRules)...)
+		// Included killfiles are reported after the killfile in the order they are included, each of them by line
+		order := map[string]int{location: 0}
+		for _, rule := range parsedRules {
+			if _, ok := order[rule.Source]; !ok {
+				order[rule.Source] = len(order)
+			}
+		}
+		for _, d := range diagnostics {
+			if _, ok := order[d.Source]; !ok {
+				order[d.Source] = len(order)
+			}
+		}
+		sort.SliceStable(diagnostics, func(i, j int) bool {
+			if order[diagnostics[i].Source] != order[diagnostics[j].Source] {
+				return order[diagnostics[i].Source] < order[diagnostics[j].Source]
+			}
+			return diagnostics[i].Line < diagnostics[j].Line
+		})
+		for _, d := range diagnostics {
+			fmt.Fprintf(w, "%s:%d:%d: %s\n\t%s\n", d.Source, d.Line, d.Column, d.Message, d.Text)
+		}
+		problems += len(diagnostics)
+	}
+
+	if problems > 0 {
+		fmt.Fprintf(w, "%d problem(s) found in %d killfile(s)\n", problems, fs.NArg())
+		return 1
+	}
+	fmt.Fprintf(w, "no problems found in %d killfile(s)\n", fs.NArg())
+	return 0
+}
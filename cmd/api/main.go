@@ -2,8 +2,10 @@ package main
 
 import (
 	"errors"
+	"expvar"
 	"flag"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"os"
@@ -22,7 +24,21 @@ import (
 )
 
 func main() {
-	fs := flag.NewFlagSet("mf", flag.ExitOnError)
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "lint":
+			os.Exit(runLint(os.Args[2:], os.Stdout))
+		case "test":
+			os.Exit(runTest(os.Args[2:], os.Stdout))
+		}
+	}
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run starts the sidekick with the command line arguments and logs to w. Unless the run-once flag is set it only
+// returns if the HTTP server stops. The report of a single run is written to stdout. It returns the exit code.
+func run(args []string, stdout, w io.Writer) int {
+	fs := flag.NewFlagSet("mf", flag.ContinueOnError)
 	var (
 		environment          = fs.String("environment", "develop", "the environment we are running in")
 		minifluxUsername     = fs.String("username", "", "the username used to log into miniflux")
@@ -31,23 +47,40 @@ func main() {
 		minifluxAPIEndpoint  = fs.String("api-endpoint", "https://rss.notmyhostna.me", "the api of your miniflux instance")
 		killfilePath         = fs.String("killfile-path", "", "the path to the local killfile")
 		killfileURL          = fs.String("killfile-url", "", "the url to the remote killfile eg. Github gist")
+		killfileSources      = fs.String("killfile-sources", "", "a comma separated list of local paths and urls of killfiles that are merged, earlier killfiles take precedence. A comma within a url has to be escaped as %2C")
+		killfileStrict       = fs.Bool("killfile-strict", false, "refuse to use a killfile if one of its lines is invalid")
 		killfileRefreshHours = fs.Int("killfile-refresh-hours", 1, "how often the rules should be updated from local or remote config (in hours)")
 		refreshInterval      = fs.String("refresh-interval", "", "interval defining how often we check for new entries in miniflux")
+		entriesPageSize      = fs.Int("entries-page-size", filter.DefaultPageSize, "the number of entries fetched from miniflux per request")
+		maxEntriesPerRun     = fs.Int("max-entries-per-run", 10000, "the maximum number of entries fetched from miniflux in one run, 0 disables the limit")
+		concurrency          = fs.Int("concurrency", filter.DefaultConcurrency, "the number of feeds that are processed at the same time")
+		updateBatchSize      = fs.Int("update-batch-size", filter.DefaultBatchSize, "the maximum number of entries updated in miniflux per request")
+		strategy             = fs.String("strategy", string(filter.StrategyAuto), "how unread entries are fetched: feed (per feed), global (all feeds at once) or auto")
+		overlapPolicy        = fs.String("overlap-policy", string(filter.OverlapSkip), "what to do if the filter job is still running when the next run is due: skip or queue")
+		statePath            = fs.String("state-path", "", "the path to the file that keeps the last evaluated entry of every feed between restarts")
+		apiRetries           = fs.Int("api-retries", filter.DefaultResilienceConfig.Attempts, "how often a request to miniflux that failed with a timeout or server error is sent")
+		apiFailureThreshold  = fs.Int("api-failure-threshold", filter.DefaultResilienceConfig.FailureThreshold, "the number of failed requests in a row after which miniflux is considered down")
+		apiCooldown          = fs.Duration("api-cooldown", filter.DefaultResilienceConfig.Cooldown, "how long no requests are sent to miniflux once it's considered down")
 		port                 = fs.String("port", "8080", "the port the miniflux sidekick is running on")
 		logLevel             = fs.String("log-level", "", "the level to filter logs at eg. debug, info, warn, error")
+		reportFormat         = fs.String("report", "", "print the report of a single run as text or json, only used with run-once")
+		runOnce              = fs.Bool("run-once", false, "run the filter job once and exit instead of scheduling it, it only changes entries in the prod environment")
 	)
 
-	ff.Parse(fs, os.Args[1:],
+	if err := ff.Parse(fs, args,
 		ff.WithConfigFileFlag("config"),
 		ff.WithConfigFileParser(ff.PlainParser),
 		ff.WithEnvVarPrefix("MF"),
-	)
+	); err != nil {
+		fmt.Fprintln(w, err)
+		return 2
+	}
 
 	if *environment == "" {
 		panic("environment can't be empty")
 	}
 
-	l := log.NewLogfmtLogger(log.NewSyncWriter(os.Stderr))
+	l := log.NewLogfmtLogger(log.NewSyncWriter(w))
 	switch strings.ToLower(*logLevel) {
 	case "debug":
 		l = level.NewFilter(l, level.AllowDebug())
@@ -74,81 +107,111 @@ func main() {
 		client = miniflux.New(*minifluxAPIEndpoint, *minifluxAPIKey)
 	} else {
 		level.Error(l).Log("err", errors.New("api endpoint, username and password or api key need to be provided"))
-		return
+		return 1
 	}
 	u, err := client.Me()
 	if err != nil {
 		level.Error(l).Log("err", err)
-		return
+		return 1
 	}
 	level.Info(l).Log("msg", "user successfully logged in", "username", u.Username, "user_id", u.ID, "is_admin", u.IsAdmin)
 
-	var t = &http.Transport{
-		Dial: (&net.Dialer{
-			Timeout: 5 * time.Second,
-		}).Dial,
-		TLSHandshakeTimeout: 5 * time.Second,
-	}
-	var c = &http.Client{
-		Timeout:   time.Second * 10,
-		Transport: t,
-	}
+	c := newHTTPClient()
 
 	// We parse our rules from disk or from an provided endpoint
 	var rr rules.Repository
-	if *killfilePath != "" {
-		level.Info(l).Log("msg", "using a local killfile", "path", *killfilePath)
-		localRepo, err := rules.NewLocalRepository()
+	if *killfileSources != "" {
+		if *killfilePath != "" || *killfileURL != "" {
+			level.Warn(l).Log("msg", "ignoring the killfile path and url as killfile sources are set")
+		}
+		level.Info(l).Log("msg", "using multiple killfiles", "sources", *killfileSources)
+		sourcesRepo, err := rules.NewSourcesRepository(c, *killfileStrict)
 		if err != nil {
 			level.Error(l).Log("err", err)
-			return
+			return 1
 		}
-		parsedRules, err := localRepo.FetchRules(*killfilePath)
+		if err := sourcesRepo.RefreshRules(*killfileSources); err != nil && !logDiagnostics(l, err, *killfileStrict) {
+			level.Error(l).Log("err", err)
+			return 1
+		}
+		rr = sourcesRepo
+		if err := refreshRulesPeriodically(l, sourcesRepo, *killfileSources, *killfileRefreshHours, *killfileStrict); err != nil {
+			level.Error(l).Log("err", err)
+			return 1
+		}
+	}
+	if *killfilePath != "" && *killfileSources == "" {
+		level.Info(l).Log("msg", "using a local killfile", "path", *killfilePath)
+		localRepo, err := rules.NewRepository(c, *killfileStrict)
 		if err != nil {
 			level.Error(l).Log("err", err)
-			return
+			return 1
+		}
+		if err := localRepo.RefreshRules(*killfilePath); err != nil && !logDiagnostics(l, err, *killfileStrict) {
+			level.Error(l).Log("err", err)
+			return 1
 		}
-		localRepo.SetCachedRules(parsedRules)
 		rr = localRepo
 	}
 	// A local rule set always trumps a remote one
-	if *killfileURL != "" && *killfilePath == "" {
+	if *killfileURL != "" && *killfilePath == "" && *killfileSources == "" {
 		level.Info(l).Log("msg", "using a remote killfile")
-		githubRepo, err := rules.NewGithubRepository(c)
+		githubRepo, err := rules.NewRepository(c, *killfileStrict)
 		if err != nil {
 			level.Error(l).Log("err", err)
-			return
+			return 1
 		}
-		parsedRules, err := githubRepo.FetchRules(*killfileURL)
-		if err != nil {
+		// Fill cache when fetched first
+		if err := githubRepo.RefreshRules(*killfileURL); err != nil && !logDiagnostics(l, err, *killfileStrict) {
 			level.Error(l).Log("err", err)
-			return
+			return 1
 		}
-		// Fill cache when fetched first
-		githubRepo.SetCachedRules(parsedRules)
 		rr = githubRepo
-
-		if *killfileRefreshHours != 0 {
-			dur, err := time.ParseDuration(fmt.Sprintf("%dh", *killfileRefreshHours))
-			if err != nil {
-				level.Error(l).Log("err", err)
-				return
-			}
-			ticker := time.NewTicker(dur)
-			go func() {
-				for {
-					select {
-					case <-ticker.C:
-						if err := githubRepo.RefreshRules(*killfileURL); err != nil {
-							level.Error(l).Log("err", err)
-						}
-					}
-				}
-			}()
+		if err := refreshRulesPeriodically(l, githubRepo, *killfileURL, *killfileRefreshHours, *killfileStrict); err != nil {
+			level.Error(l).Log("err", err)
+			return 1
 		}
 	}
 
-	filterService := filter.NewService(l, client, rr)
+	stateStore := filter.NewMemoryStateStore()
+	if *statePath != "" {
+		stateStore = filter.NewFileStateStore(*statePath)
+	}
+	st, err := filter.ParseStrategy(*strategy)
+	if err != nil {
+		level.Error(l).Log("err", err)
+		return 1
+	}
+	policy, err := filter.ParseOverlapPolicy(*overlapPolicy)
+	if err != nil {
+		level.Error(l).Log("err", err)
+		return 1
+	}
+	resilientClient := filter.NewResilientClient(client, l, filter.ResilienceConfig{
+		Attempts:         *apiRetries,
+		FailureThreshold: *apiFailureThreshold,
+		Cooldown:         *apiCooldown,
+	})
+	filterService := filter.NewService(l, resilientClient, rr, filter.Config{
+		PageSize:         *entriesPageSize,
+		MaxEntriesPerRun: *maxEntriesPerRun,
+		Concurrency:      *concurrency,
+		BatchSize:        *updateBatchSize,
+		StateStore:       stateStore,
+		Strategy:         st,
+		OverlapPolicy:    policy,
+	})
+
+	if *runOnce {
+		simulation := strings.ToLower(*environment) != "prod"
+		level.Info(l).Log("msg", "running filter job once", "env", *environment, "simulation", simulation)
+		filterService.RunFilterJob(simulation)
+		if err := writeReport(stdout, filterService.LastReport(), *reportFormat); err != nil {
+			level.Error(l).Log("err", err)
+			return 1
+		}
+		return 0
+	}
 
 	cron := cron.New()
 	// Set a fallback, documented in README
@@ -184,13 +247,19 @@ func main() {
 	<table>
 	<tr>
 		<th>Command</th>
+		<th>Category</th>
 		<th>URL</th>
 		<th>Filter Expression</th>
+		<th>Origin</th>
+		<th>Defined in</th>
 	</tr>
 	{{range .}}
 		<td>{{ .Command }}</td>
+		<td>{{ .Scope }}</td>
 		<td>{{ .URL }}</td>
 		<td>{{ .FilterExpression }}</td>
+		<td>{{ .Origin }}</td>
+		<td>{{ .Source }}:{{ .Line }}</td>
 		</tr>
 	{{end}}
 	</table>
@@ -198,12 +267,30 @@ func main() {
 	</html>`)
 	if err != nil {
 		level.Error(l).Log("err", err)
-		return
+		return 1
 	}
 
 	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
 		tmpl.Execute(w, rr.Rules())
 	})
+	r.Get("/report", func(w http.ResponseWriter, r *http.Request) {
+		report := filterService.LastReport()
+		if report == nil {
+			http.Error(w, "the filter job didn't run yet", http.StatusNotFound)
+			return
+		}
+		format := r.URL.Query().Get("format")
+		if format == "text" {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		} else {
+			format = "json"
+			w.Header().Set("Content-Type", "application/json")
+		}
+		if err := writeReport(w, report, format); err != nil {
+			level.Error(l).Log("err", err)
+		}
+	})
+	r.Handle("/debug/vars", expvar.Handler())
 
 	level.Info(l).Log("msg", fmt.Sprintf("miniflux-sidekick api is running on :%s", *port), "environment", *environment)
 
@@ -211,6 +298,77 @@ func main() {
 	err = http.ListenAndServe(fmt.Sprintf(":%s", *port), r)
 	if err != nil {
 		level.Error(l).Log("err", err)
-		return
+		return 1
+	}
+	return 0
+}
+
+// refreshRulesPeriodically refreshes the rules of the repository every few hours in the background, zero hours
+// disables the refresh. If the refreshed rules can't be used the previous rules are kept.
+func refreshRulesPeriodically(l log.Logger, rr rules.Repository, location string, hours int, strict bool) error {
+	if hours == 0 {
+		return nil
+	}
+	dur, err := time.ParseDuration(fmt.Sprintf("%dh", hours))
+	if err != nil {
+		return err
+	}
+	ticker := time.NewTicker(dur)
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				if err := rr.RefreshRules(location); err != nil && !logDiagnostics(l, err, strict) {
+					level.Error(l).Log("msg", "keeping the previous rules", "err", err)
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// writeReport writes the report in the given format, nothing is written if the format is empty
+func writeReport(w io.Writer, report *filter.Report, format string) error {
+	switch {
+	case format == "":
+		return nil
+	case report == nil:
+		return errors.New("there's no report, the filter job didn't run")
+	case format == "text":
+		return report.WriteText(w)
+	case format == "json":
+		return report.WriteJSON(w)
+	}
+	return fmt.Errorf("unknown report format %q, has to be text or json", format)
+}
+
+// newHTTPClient returns the client used to fetch remote killfiles
+func newHTTPClient() *http.Client {
+	var t = &http.Transport{
+		Dial: (&net.Dialer{
+			Timeout: 5 * time.Second,
+		}).Dial,
+		TLSHandshakeTimeout: 5 * time.Second,
+	}
+	return &http.Client{
+		Timeout:   time.Second * 10,
+		Transport: t,
+	}
+}
+
+// logDiagnostics logs the invalid lines of a killfile. It returns false if the error isn't caused by invalid lines or
+// if they can't be skipped because strict mode is enabled.
+func logDiagnostics(l log.Logger, err error, strict bool) bool {
+	diagnostics, ok := err.(rules.Diagnostics)
+	if !ok {
+		return false
+	}
+	for _, d := range diagnostics {
+		logger := level.Warn(l)
+		if strict {
+			logger = level.Error(l)
+		}
+		logger.Log("msg", "invalid killfile line", "source", d.Source, "line", d.Line, "column", d.Column, "reason", d.Message, "text", d.Text, "strict", strict)
 	}
+	return !strict
 }
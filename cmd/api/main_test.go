@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/dewey/miniflux-sidekick/filter"
+	"github.com/dewey/miniflux-sidekick/minifluxtest"
+	miniflux "miniflux.app/client"
+)
+
+func TestRunOnce(t *testing.T) {
+	tests := []struct {
+		name        string
+		environment string
+		wantStatus  map[int64]string
+		wantStarred []int64
+		// wantSimulation and wantReported describe the printed report, wantReported is the number of matched entries
+		wantSimulation bool
+		wantReported   int
+	}{
+		{
+			name:        "Destructive",
+			environment: "prod",
+			wantStatus: map[int64]string{
+				1: miniflux.EntryStatusRead,
+				2: miniflux.EntryStatusUnread,
+				3: miniflux.EntryStatusUnread,
+				4: miniflux.EntryStatusRemoved,
+				5: miniflux.EntryStatusUnread,
+				6: miniflux.EntryStatusRead,
+			},
+			wantStarred:  []int64{5},
+			wantReported: 3,
+		},
+		{
+			name:           "Simulation",
+			environment:    "development",
+			wantSimulation: true,
+			wantReported:   3,
+			wantStatus: map[int64]string{
+				1: miniflux.EntryStatusUnread,
+				2: miniflux.EntryStatusUnread,
+				3: miniflux.EntryStatusUnread,
+				4: miniflux.EntryStatusUnread,
+				5: miniflux.EntryStatusUnread,
+				6: miniflux.EntryStatusRead,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := minifluxtest.NewClient()
+			f, err := os.Open("testdata/fixture.json")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			if err := client.LoadFixture(f); err != nil {
+				t.Fatal(err)
+			}
+			srv := minifluxtest.NewServer(client)
+			defer srv.Close()
+
+			var stdout, logs bytes.Buffer
+			code := run([]string{
+				"-environment", tt.environment,
+				"-api-endpoint", srv.URL,
+				"-api-key", "secret",
+				"-killfile-path", "testdata/killfile",
+				"-run-once",
+				"-report", "json",
+			}, &stdout, &logs)
+			if code != 0 {
+				t.Fatalf("run() = %d, want 0, logs:\n%s", code, logs.String())
+			}
+
+			var report filter.Report
+			if err := json.Unmarshal(stdout.Bytes(), &report); err != nil {
+				t.Fatalf("run() printed an invalid report: %v\n%s", err, stdout.String())
+			}
+			if report.Simulation != tt.wantSimulation || len(report.Entries) != tt.wantReported {
+				t.Errorf("run() printed a report with simulation %v and %d entries, want %v and %d", report.Simulation, len(report.Entries), tt.wantSimulation, tt.wantReported)
+			}
+
+			for id, want := range tt.wantStatus {
+				if got := client.Status(id); got != want {
+					t.Errorf("run() entry %d has status %q, want %q", id, got, want)
+				}
+			}
+			for id := range tt.wantStatus {
+				want := false
+				for _, starred := range tt.wantStarred {
+					want = want || starred == id
+				}
+				if got := client.Starred(id); got != want {
+					t.Errorf("run() entry %d starred = %v, want %v", id, got, want)
+				}
+			}
+		})
+	}
+}
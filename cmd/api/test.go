@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/dewey/miniflux-sidekick/filter"
+	"github.com/dewey/miniflux-sidekick/rules"
+	"github.com/go-kit/kit/log"
+	miniflux "miniflux.app/client"
+)
+
+// fixtureEntry is a Miniflux entry with an optional expectation, either "kill" or "keep"
+type fixtureEntry struct {
+	miniflux.Entry
+	Expect string `json:"expect"`
+}
+
+// runTest evaluates a killfile against a fixture of entries without talking to Miniflux. It returns the exit code:
+// 0 if all expectations are met, 1 if some are not and 2 if the killfile or fixture couldn't be read.
+func runTest(args []string, w io.Writer) int {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(w)
+	fs.Usage = func() {
+		fmt.Fprintln(w, "usage: miniflux-sidekick test <killfile-path-or-url> <entries.json>")
+		fmt.Fprintln(w, "")
+		fmt.Fprintln(w, `The entries file contains Miniflux entries as a JSON array or as one JSON object per line. An entry can contain
+an "expect" field set to "kill" or "keep" to make the test fail if the killfile doesn't do what's expected.
+Rules only apply to the entries of the feeds they select, so entries should contain their "feed" (at least its
+"feed_url"). Only the rules for all feeds (*) apply to entries without a feed.`)
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return 2
+	}
+	location, fixture := fs.Arg(0), fs.Arg(1)
+
+	repo, err := rules.NewRepository(newHTTPClient(), true)
+	if err != nil {
+		fmt.Fprintf(w, "%s: %s\n", location, err)
+		return 2
+	}
+	if err := repo.RefreshRules(location); err != nil {
+		if diagnostics, ok := err.(rules.Diagnostics); ok {
+			for _, d := range diagnostics {
+				fmt.Fprintln(w, d)
+			}
+			fmt.Fprintf(w, "%s is invalid, run the lint subcommand for details\n", location)
+			return 2
+		}
+		fmt.Fprintf(w, "%s: %s\n", location, err)
+		return 2
+	}
+
+	entries, err := readFixture(fixture)
+	if err != nil {
+		fmt.Fprintf(w, "%s: %s\n", fixture, err)
+		return 2
+	}
+
+	// Without a feed only the wildcard rules apply to an entry, that's pointed out if there are other rules
+	var feedRules bool
+	for _, rule := range repo.RuleSet().Compiled() {
+		feedRules = feedRules || !rule.Selector.All() || rule.Scoped()
+	}
+
+	filterService := filter.NewService(log.NewNopLogger(), nil, repo, filter.Config{})
+	var killed, failed int
+	for _, entry := range entries {
+		evaluation := filterService.EvaluateEntry(&entry.Entry)
+		result := "keep"
+		if evaluation.Killed() {
+			result = "kill"
+			killed++
+		}
+		status := "ok  "
+		if entry.Expect != "" && entry.Expect != result {
+			status = "FAIL"
+			failed++
+		}
+		fmt.Fprintf(w, "%s %s entry_id=%d title=%q", status, result, entry.ID, entry.Title)
+		if status == "FAIL" {
+			fmt.Fprintf(w, " expected=%s", entry.Expect)
+		}
+		fmt.Fprintln(w)
+		if entry.Feed == nil && feedRules {
+			fmt.Fprintln(w, "\tthe entry has no feed, only the rules for all feeds (*) apply to it")
+		}
+		for _, m := range evaluation.Matches {
+			printMatch(w, string(m.Action), m)
+		}
+		if evaluation.Keep != nil {
+			printMatch(w, "protected", *evaluation.Keep)
+		}
+	}
+
+	fmt.Fprintf(w, "%d entries, %d killed, %d kept, %d failed expectation(s)\n", len(entries), killed, len(entries)-killed, failed)
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+func printMatch(w io.Writer, action string, m filter.Match) {
+	fmt.Fprintf(w, "\t%s by %s:%d (%s) matched %s=%q\n", action, m.Rule.Source, m.Rule.Line, m.Rule, m.Attribute, m.Text)
+}
+
+// readFixture reads entries from a JSON array or from a file with one JSON object per line
+func readFixture(path string) ([]fixtureEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	r := bufio.NewReader(file)
+	for {
+		b, err := r.Peek(1)
+		if err == io.EOF {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if b[0] != ' ' && b[0] != '\t' && b[0] != '\r' && b[0] != '\n' {
+			break
+		}
+		r.ReadByte()
+	}
+
+	var entries []fixtureEntry
+	dec := json.NewDecoder(r)
+	if b, _ := r.Peek(1); b[0] == '[' {
+		if err := dec.Decode(&entries); err != nil {
+			return nil, err
+		}
+	} else {
+		for {
+			var entry fixtureEntry
+			err := dec.Decode(&entry)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, entry)
+		}
+	}
+
+	for _, entry := range entries {
+		if entry.Expect != "" && entry.Expect != "kill" && entry.Expect != "keep" {
+			return nil, fmt.Errorf("entry %d: expect has to be kill or keep, not %q", entry.ID, entry.Expect)
+		}
+	}
+	return entries, nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRunTest(t *testing.T) {
+	tests := []struct {
+		name     string
+		killfile string
+		fixture  string
+		wantCode int
+		// wantOutput are lines the output has to contain
+		wantOutput []string
+	}{
+		{
+			name:     "JSON array",
+			killfile: "testdata/killfile",
+			fixture:  "testdata/entries.json",
+			wantCode: 0,
+			wantOutput: []string{
+				`ok   kill entry_id=1 title="Lunar eclipse"`,
+				`ok   keep entry_id=2 title="Sun"`,
+				`2 entries, 1 killed, 1 kept, 0 failed expectation(s)`,
+			},
+		},
+		{
+			name:     "JSON object per line",
+			killfile: "testdata/killfile",
+			fixture:  "testdata/entries.jsonl",
+			wantCode: 0,
+			wantOutput: []string{
+				`ok   kill entry_id=1 title="Lunar eclipse"`,
+				`ok   keep entry_id=2 title="Moon"`,
+				`	protected by testdata/killfile:5`,
+				`ok   kill entry_id=3 title="[Sponsor] Telescopes"` + "\n\tthe entry has no feed, only the rules for all feeds (*) apply to it",
+				`ok   keep entry_id=4 title="Sun"`,
+				`4 entries, 2 killed, 2 kept, 0 failed expectation(s)`,
+			},
+		},
+		{
+			name:     "Failed expectation",
+			killfile: "testdata/killfile",
+			fixture:  "testdata/entries-failed.jsonl",
+			wantCode: 1,
+			wantOutput: []string{
+				`FAIL keep entry_id=1 title="Sun" expected=kill`,
+				`ok   kill entry_id=2 title="Moon"`,
+				`2 entries, 1 killed, 1 kept, 1 failed expectation(s)`,
+			},
+		},
+		{
+			name:       "Invalid expectation",
+			killfile:   "testdata/killfile",
+			fixture:    "testdata/entries-invalid-expect.jsonl",
+			wantCode:   2,
+			wantOutput: []string{`testdata/entries-invalid-expect.jsonl: entry 1: expect has to be kill or keep, not "maybe"`},
+		},
+		{
+			name:     "Invalid killfile",
+			killfile: "testdata/invalid-killfile",
+			fixture:  "testdata/entries.json",
+			wantCode: 2,
+			wantOutput: []string{
+				`testdata/invalid-killfile:2:19: invalid filter expression: unknown attribute "titel"`,
+				`testdata/invalid-killfile is invalid, run the lint subcommand for details`,
+			},
+		},
+		{
+			name:       "Missing fixture",
+			killfile:   "testdata/killfile",
+			fixture:    "testdata/does-not-exist.json",
+			wantCode:   2,
+			wantOutput: []string{"testdata/does-not-exist.json: open testdata/does-not-exist.json"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			if got := runTest([]string{tt.killfile, tt.fixture}, &out); got != tt.wantCode {
+				t.Errorf("runTest() = %d, want %d, output:\n%s", got, tt.wantCode, out.String())
+			}
+			for _, want := range tt.wantOutput {
+				if !strings.Contains(out.String(), want) {
+					t.Errorf("runTest() output doesn't contain %q:\n%s", want, out.String())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,236 @@
+package expr
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	miniflux "miniflux.app/client"
+)
+
+// Node is a parsed filter expression that can be evaluated against an entry
+type Node interface {
+	// Eval returns true if the entry matches the expression
+	Eval(entry *miniflux.Entry) bool
+
+	// Match is like Eval but also explains which comparison matched. It's slower than Eval and meant to be called
+	// once an entry is known to match.
+	Match(entry *miniflux.Entry) (Match, bool)
+
+	// String returns the normalized form of the expression
+	String() string
+}
+
+// Match explains why an entry matched an expression
+type Match struct {
+	// Attribute, Operator and Value are the comparison that matched
+	Attribute string
+	Operator  string
+	Value     string
+
+	// Text is the matched part of the attribute. Start and End are the byte offsets of it in the attribute, for
+	// operators that don't match a part of the attribute the span covers the whole attribute.
+	Text       string
+	Start, End int
+}
+
+// And matches if both sides match
+type And struct {
+	Left, Right Node
+}
+
+// Eval implements Node
+func (n *And) Eval(entry *miniflux.Entry) bool {
+	return n.Left.Eval(entry) && n.Right.Eval(entry)
+}
+
+// Match implements Node, it explains the match with the left side
+func (n *And) Match(entry *miniflux.Entry) (Match, bool) {
+	m, ok := n.Left.Match(entry)
+	if !ok || !n.Right.Eval(entry) {
+		return Match{}, false
+	}
+	return m, true
+}
+
+func (n *And) String() string {
+	return "(" + n.Left.String() + " and " + n.Right.String() + ")"
+}
+
+// Or matches if one of the sides matches
+type Or struct {
+	Left, Right Node
+}
+
+// Eval implements Node
+func (n *Or) Eval(entry *miniflux.Entry) bool {
+	return n.Left.Eval(entry) || n.Right.Eval(entry)
+}
+
+// Match implements Node, it explains the match with the first side that matches
+func (n *Or) Match(entry *miniflux.Entry) (Match, bool) {
+	if m, ok := n.Left.Match(entry); ok {
+		return m, true
+	}
+	return n.Right.Match(entry)
+}
+
+func (n *Or) String() string {
+	return "(" + n.Left.String() + " or " + n.Right.String() + ")"
+}
+
+// Comparison compares an attribute of the entry with a value, e.g. `title =~ \[Sponsor\]`
+type Comparison struct {
+	Attribute string
+	Operator  string
+	Value     string
+
+	attr         attribute
+	literal      value
+	lower, upper value
+	re           *regexp.Regexp
+	terms        []string
+}
+
+func knownOperator(op string) bool {
+	switch op {
+	case "=~", "!~", "#", "!#", "=", "!=", "<", ">", "<=", ">=", operatorBetween:
+		return true
+	}
+	return false
+}
+
+func newComparison(attr attribute, name, operator, v string) (*Comparison, error) {
+	c := &Comparison{
+		Attribute: name,
+		Operator:  operator,
+		Value:     v,
+		attr:      attr,
+	}
+	switch operator {
+	case "=~", "!~":
+		re, err := regexp.Compile(v)
+		if err != nil {
+			return nil, err
+		}
+		c.re = re
+	case "#", "!#":
+		c.terms = strings.Split(v, ",")
+		for _, term := range c.terms {
+			// Every text contains the empty string, a term like that would match all entries
+			if term == "" {
+				return nil, fmt.Errorf("%q contains an empty term, it would match every entry", v)
+			}
+		}
+	case operatorBetween:
+		lower, upper, err := parseRange(c.attr.kind, v)
+		if err != nil {
+			return nil, err
+		}
+		c.lower, c.upper = lower, upper
+	default:
+		literal, err := parseValue(c.attr.kind, v)
+		if err != nil {
+			return nil, err
+		}
+		c.literal = literal
+	}
+	return c, nil
+}
+
+// Eval implements Node
+func (c *Comparison) Eval(entry *miniflux.Entry) bool {
+	v := c.attr.value(entry)
+	switch c.Operator {
+	case "=~":
+		return c.re.MatchString(v.String())
+	case "!~":
+		return !c.re.MatchString(v.String())
+	case "#":
+		return containsTerm(v.String(), c.terms)
+	case "!#":
+		return !containsTerm(v.String(), c.terms)
+	case "=":
+		return equal(v, c.literal)
+	case "!=":
+		return !equal(v, c.literal)
+	case operatorBetween:
+		lower, ok := compare(v, c.lower)
+		if !ok {
+			return false
+		}
+		upper, ok := compare(v, c.upper)
+		return ok && lower >= 0 && upper <= 0
+	}
+	cmp, ok := compare(v, c.literal)
+	if !ok {
+		return false
+	}
+	switch c.Operator {
+	case "<":
+		return cmp < 0
+	case ">":
+		return cmp > 0
+	case "<=":
+		return cmp <= 0
+	case ">=":
+		return cmp >= 0
+	}
+	return false
+}
+
+// Match implements Node
+func (c *Comparison) Match(entry *miniflux.Entry) (Match, bool) {
+	if !c.Eval(entry) {
+		return Match{}, false
+	}
+	target := c.attr.value(entry).String()
+	m := Match{
+		Attribute: c.Attribute,
+		Operator:  c.Operator,
+		Value:     c.Value,
+		Text:      target,
+		End:       len(target),
+	}
+	switch c.Operator {
+	case "=~":
+		loc := c.re.FindStringIndex(target)
+		m.Start, m.End = loc[0], loc[1]
+	case "#":
+		for _, t := range c.terms {
+			if i := strings.Index(target, t); i >= 0 {
+				m.Start, m.End = i, i+len(t)
+				break
+			}
+		}
+	}
+	m.Text = target[m.Start:m.End]
+	return m, true
+}
+
+// equal compares text exactly and numbers and dates by their value
+func equal(a, b value) bool {
+	if a.kind == kindString && b.kind == kindString {
+		return a.str == b.str
+	}
+	cmp, ok := compare(a, b)
+	return ok && cmp == 0
+}
+
+func (c *Comparison) String() string {
+	return c.Attribute + " " + c.Operator + " " + quote(c.Value)
+}
+
+// quote is the inverse of the quoted value lexing
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+func containsTerm(s string, terms []string) bool {
+	for _, t := range terms {
+		if strings.Contains(s, t) {
+			return true
+		}
+	}
+	return false
+}
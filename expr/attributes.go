@@ -0,0 +1,109 @@
+package expr
+
+import (
+	"time"
+
+	miniflux "miniflux.app/client"
+)
+
+// now is used to calculate the age of an entry, it's replaced in tests
+var now = time.Now
+
+// attribute describes an entry attribute that can be used in filter expressions
+type attribute struct {
+	kind  kind
+	value func(entry *miniflux.Entry) value
+
+	// volatile attributes can change after an entry was fetched, e.g. with time or by the user
+	volatile bool
+}
+
+func stringAttribute(fn func(entry *miniflux.Entry) string) attribute {
+	return attribute{
+		kind:  kindString,
+		value: func(entry *miniflux.Entry) value { return stringValue(fn(entry)) },
+	}
+}
+
+// attributes maps the names of the newsboat attributes (https://newsboat.org/releases/2.15/docs/newsboat.html#_filter_language)
+// to the fields of a Miniflux entry
+var attributes = map[string]attribute{
+	"title":       stringAttribute(func(entry *miniflux.Entry) string { return entry.Title }),
+	"content":     stringAttribute(func(entry *miniflux.Entry) string { return entry.Content }),
+	"description": stringAttribute(func(entry *miniflux.Entry) string { return entry.Content }),
+	"author":      stringAttribute(func(entry *miniflux.Entry) string { return entry.Author }),
+	"link":        stringAttribute(func(entry *miniflux.Entry) string { return entry.URL }),
+	"url":         stringAttribute(func(entry *miniflux.Entry) string { return entry.URL }),
+	"feedtitle": stringAttribute(func(entry *miniflux.Entry) string {
+		if entry.Feed == nil {
+			return ""
+		}
+		return entry.Feed.Title
+	}),
+	"feedurl": stringAttribute(func(entry *miniflux.Entry) string {
+		if entry.Feed == nil {
+			return ""
+		}
+		return entry.Feed.FeedURL
+	}),
+	"category": stringAttribute(func(entry *miniflux.Entry) string {
+		if entry.Feed == nil || entry.Feed.Category == nil {
+			return ""
+		}
+		return entry.Feed.Category.Title
+	}),
+	// Feeds usually only contain one enclosure per entry, like newsboat we only look at the first one
+	"enclosure_url": stringAttribute(func(entry *miniflux.Entry) string {
+		if len(entry.Enclosures) == 0 || entry.Enclosures[0] == nil {
+			return ""
+		}
+		return entry.Enclosures[0].URL
+	}),
+	"enclosure_type": stringAttribute(func(entry *miniflux.Entry) string {
+		if len(entry.Enclosures) == 0 || entry.Enclosures[0] == nil {
+			return ""
+		}
+		return entry.Enclosures[0].MimeType
+	}),
+	"starred": {
+		kind: kindString,
+		value: func(entry *miniflux.Entry) value {
+			if entry.Starred {
+				return stringValue("yes")
+			}
+			return stringValue("no")
+		},
+		volatile: true,
+	},
+	"pubDate": {
+		kind:  kindDate,
+		value: func(entry *miniflux.Entry) value { return dateValue(entry.Date) },
+	},
+	"age": {
+		kind: kindInt,
+		value: func(entry *miniflux.Entry) value {
+			return intValue(int64(now().Sub(entry.Date).Hours() / 24))
+		},
+		volatile: true,
+	},
+}
+
+// lookupAttribute returns the attribute with the given name
+func lookupAttribute(name string) (attribute, bool) {
+	a, ok := attributes[name]
+	return a, ok
+}
+
+// Volatile reports whether the expression uses an attribute that can change after an entry was fetched, like its
+// age. An entry that didn't match such an expression before might match it later.
+func Volatile(n Node) bool {
+	switch n := n.(type) {
+	case *And:
+		return Volatile(n.Left) || Volatile(n.Right)
+	case *Or:
+		return Volatile(n.Left) || Volatile(n.Right)
+	case *Comparison:
+		return n.attr.volatile
+	}
+	return false
+}
@@ -0,0 +1,158 @@
+package expr
+
+import (
+	"strings"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenOperator
+	tokenValue
+	tokenLParen
+	tokenRParen
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// lexer splits a filter expression into tokens. Values are lexed on demand by the parser as an unquoted value
+// can contain characters that would otherwise be treated as operators or parentheses, e.g. `(?i)(moon|lunar)`.
+type lexer struct {
+	input string
+	pos   int
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n'
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+func isOperatorChar(c byte) bool {
+	return strings.IndexByte("=!~#<>", c) >= 0
+}
+
+func (l *lexer) skipSpace() {
+	for l.pos < len(l.input) && isSpace(l.input[l.pos]) {
+		l.pos++
+	}
+}
+
+// next returns the next attribute, operator, keyword or parenthesis
+func (l *lexer) next() (token, error) {
+	l.skipSpace()
+	start := l.pos
+	if l.pos >= len(l.input) {
+		return token{kind: tokenEOF, pos: start}, nil
+	}
+	c := l.input[l.pos]
+	switch {
+	case c == '(':
+		l.pos++
+		return token{kind: tokenLParen, text: "(", pos: start}, nil
+	case c == ')':
+		l.pos++
+		return token{kind: tokenRParen, text: ")", pos: start}, nil
+	case isOperatorChar(c):
+		for l.pos < len(l.input) && isOperatorChar(l.input[l.pos]) {
+			l.pos++
+		}
+		return token{kind: tokenOperator, text: l.input[start:l.pos], pos: start}, nil
+	case isIdentChar(c):
+		for l.pos < len(l.input) && isIdentChar(l.input[l.pos]) {
+			l.pos++
+		}
+		return token{kind: tokenIdent, text: l.input[start:l.pos], pos: start}, nil
+	}
+	return token{}, &SyntaxError{Offset: start, Msg: "unexpected character " + string(c)}
+}
+
+// value returns the comparison value following an operator. Quoted values support \" and \\ as escape sequences,
+// every other backslash is kept so regular expressions like "\[Sponsor\]" don't need double escaping. Unquoted values
+// run until the end of the expression, an unbalanced closing parenthesis or an "and" / "or" keyword.
+func (l *lexer) value() (token, error) {
+	l.skipSpace()
+	start := l.pos
+	if l.pos >= len(l.input) {
+		return token{}, &SyntaxError{Offset: start, Msg: "missing value"}
+	}
+	if l.input[l.pos] == '"' {
+		return l.quoted()
+	}
+
+	var depth int
+loop:
+	for l.pos < len(l.input) {
+		switch c := l.input[l.pos]; {
+		case c == '\\':
+			l.pos++
+		case c == '(':
+			depth++
+		case c == ')':
+			if depth == 0 {
+				break loop
+			}
+			depth--
+		case isSpace(c):
+			if l.keywordAhead() {
+				break loop
+			}
+		}
+		l.pos++
+	}
+	if l.pos > len(l.input) {
+		l.pos = len(l.input)
+	}
+	text := strings.TrimRight(l.input[start:l.pos], " \t\r\n")
+	if text == "" {
+		return token{}, &SyntaxError{Offset: start, Msg: "missing value"}
+	}
+	return token{kind: tokenValue, text: text, pos: start}, nil
+}
+
+// keywordAhead reports whether the whitespace at the current position is followed by a boolean keyword
+func (l *lexer) keywordAhead() bool {
+	i := l.pos
+	for i < len(l.input) && isSpace(l.input[i]) {
+		i++
+	}
+	for _, kw := range []string{keywordAnd, keywordOr} {
+		if !strings.HasPrefix(l.input[i:], kw) {
+			continue
+		}
+		end := i + len(kw)
+		if end == len(l.input) || isSpace(l.input[end]) || l.input[end] == '(' {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *lexer) quoted() (token, error) {
+	start := l.pos
+	l.pos++
+	var b strings.Builder
+	for l.pos < len(l.input) {
+		c := l.input[l.pos]
+		switch {
+		case c == '"':
+			l.pos++
+			return token{kind: tokenValue, text: b.String(), pos: start}, nil
+		case c == '\\' && l.pos+1 < len(l.input) && (l.input[l.pos+1] == '"' || l.input[l.pos+1] == '\\'):
+			b.WriteByte(l.input[l.pos+1])
+			l.pos += 2
+		default:
+			b.WriteByte(c)
+			l.pos++
+		}
+	}
+	return token{}, &SyntaxError{Offset: start, Msg: "unterminated string"}
+}
@@ -0,0 +1,158 @@
+package expr
+
+import (
+	"fmt"
+)
+
+const (
+	keywordAnd      = "and"
+	keywordOr       = "or"
+	operatorBetween = "between"
+)
+
+// SyntaxError is returned if a filter expression can't be parsed. Offset is the byte offset in the expression.
+type SyntaxError struct {
+	Offset int
+	Msg    string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("%s at offset %d", e.Msg, e.Offset)
+}
+
+// Parse parses a filter expression into an executable tree. The grammar follows the newsboat filter language
+// (https://newsboat.org/releases/2.15/docs/newsboat.html#_filter_language):
+//
+//	expression = term { "or" term }
+//	term       = factor { "and" factor }
+//	factor     = "(" expression ")" | attribute operator value
+//
+// "and" binds stronger than "or", values can either be quoted or unquoted.
+func Parse(input string) (Node, error) {
+	p := &parser{lex: &lexer{input: input}}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	n, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokenEOF {
+		return nil, p.unexpected()
+	}
+	return n, nil
+}
+
+type parser struct {
+	lex *lexer
+	tok token
+}
+
+func (p *parser) advance() error {
+	t, err := p.lex.next()
+	if err != nil {
+		return err
+	}
+	p.tok = t
+	return nil
+}
+
+func (p *parser) unexpected() error {
+	if p.tok.kind == tokenEOF {
+		return &SyntaxError{Offset: p.tok.pos, Msg: "unexpected end of expression"}
+	}
+	return &SyntaxError{Offset: p.tok.pos, Msg: fmt.Sprintf("unexpected %q", p.tok.text)}
+}
+
+func (p *parser) isKeyword(kw string) bool {
+	return p.tok.kind == tokenIdent && p.tok.text == kw
+}
+
+func (p *parser) expression() (Node, error) {
+	left, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword(keywordOr) {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		right, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		left = &Or{Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) term() (Node, error) {
+	left, err := p.factor()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword(keywordAnd) {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		right, err := p.factor()
+		if err != nil {
+			return nil, err
+		}
+		left = &And{Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) factor() (Node, error) {
+	switch {
+	case p.tok.kind == tokenLParen:
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		n, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		if p.tok.kind != tokenRParen {
+			return nil, p.unexpected()
+		}
+		return n, p.advance()
+	case p.tok.kind == tokenIdent && !p.isKeyword(keywordAnd) && !p.isKeyword(keywordOr):
+		return p.comparison()
+	}
+	return nil, p.unexpected()
+}
+
+func (p *parser) comparison() (Node, error) {
+	name := p.tok
+	attr, ok := lookupAttribute(name.text)
+	if !ok {
+		return nil, &SyntaxError{Offset: name.pos, Msg: fmt.Sprintf("unknown attribute %q", name.text)}
+	}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	if p.tok.kind == tokenIdent && p.tok.text == operatorBetween {
+		p.tok.kind = tokenOperator
+	}
+	if p.tok.kind != tokenOperator {
+		if p.tok.kind == tokenEOF {
+			return nil, &SyntaxError{Offset: p.tok.pos, Msg: "missing operator"}
+		}
+		return nil, p.unexpected()
+	}
+	operator := p.tok
+	if !knownOperator(operator.text) {
+		return nil, &SyntaxError{Offset: operator.pos, Msg: fmt.Sprintf("unknown operator %q", operator.text)}
+	}
+	value, err := p.lex.value()
+	if err != nil {
+		return nil, err
+	}
+	c, err := newComparison(attr, name.text, operator.text, value.text)
+	if err != nil {
+		return nil, &SyntaxError{Offset: value.pos, Msg: err.Error()}
+	}
+	return c, p.advance()
+}
@@ -0,0 +1,428 @@
+package expr
+
+import (
+	"testing"
+	"time"
+
+	miniflux "miniflux.app/client"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:  "Single comparison with unquoted value",
+			input: `title =~ \[Sponsor\]`,
+			want:  `title =~ "\\[Sponsor\\]"`,
+		},
+		{
+			name:  "Unquoted value with parentheses",
+			input: "title =~ (?i)(Podcast|scooter)",
+			want:  `title =~ "(?i)(Podcast|scooter)"`,
+		},
+		{
+			name:  "Unquoted value with spaces",
+			input: "title # Weekly Sponsor",
+			want:  `title # "Weekly Sponsor"`,
+		},
+		{
+			name:  "Quoted values combined with and",
+			input: `title =~ "Sponsor" and description # "Bob"`,
+			want:  `(title =~ "Sponsor" and description # "Bob")`,
+		},
+		{
+			name:  "And binds stronger than or",
+			input: `title # a or title # b and title # c`,
+			want:  `(title # "a" or (title # "b" and title # "c"))`,
+		},
+		{
+			name:  "Parentheses with unquoted values",
+			input: `(title # Moon) or (description =~ eclipse)`,
+			want:  `(title # "Moon" or description =~ "eclipse")`,
+		},
+		{
+			name:  "Escaped quote in quoted value",
+			input: `title # "say \"hi\""`,
+			want:  `title # "say \"hi\""`,
+		},
+		{
+			name:  "Equality and ordering operators",
+			input: `title = "Sun" or title != Moon and title >= 10`,
+			want:  `(title = "Sun" or (title != "Moon" and title >= "10"))`,
+		},
+		{
+			name:  "Between operator",
+			input: "title between 1:7",
+			want:  `title between "1:7"`,
+		},
+		{
+			name:    "Between with an invalid range",
+			input:   "title between 7",
+			wantErr: true,
+		},
+		{
+			name:    "Between with a reversed range",
+			input:   "title between 7:1",
+			wantErr: true,
+		},
+		{
+			name:    "Empty term",
+			input:   "title # Lunar,Moon,",
+			wantErr: true,
+		},
+		{
+			name:    "Empty value",
+			input:   `title !# ""`,
+			wantErr: true,
+		},
+		{
+			name:    "Unknown attribute",
+			input:   "headline # Moon",
+			wantErr: true,
+		},
+		{
+			name:    "Integer attribute with text value",
+			input:   "age > week",
+			wantErr: true,
+		},
+		{
+			name:    "Date attribute with invalid date",
+			input:   "pubDate < yesterday",
+			wantErr: true,
+		},
+		{
+			name:    "Missing value",
+			input:   "title =~",
+			wantErr: true,
+		},
+		{
+			name:    "Missing operator",
+			input:   "title",
+			wantErr: true,
+		},
+		{
+			name:    "Unknown operator",
+			input:   "title ~= foo",
+			wantErr: true,
+		},
+		{
+			name:    "Invalid regular expression",
+			input:   "title =~ (foo",
+			wantErr: true,
+		},
+		{
+			name:    "Unbalanced parentheses",
+			input:   "(title # Moon",
+			wantErr: true,
+		},
+		{
+			name:    "Unterminated string",
+			input:   `title # "Moon`,
+			wantErr: true,
+		},
+		{
+			name:    "Dangling and",
+			input:   `title # "Moon" and`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				if _, ok := err.(*SyntaxError); !ok {
+					t.Errorf("Parse() error type = %T, want *SyntaxError", err)
+				}
+				return
+			}
+			if got.String() != tt.want {
+				t.Errorf("Parse() = %s, want %s", got.String(), tt.want)
+			}
+			// The normalized form has to parse into the same expression again
+			again, err := Parse(got.String())
+			if err != nil {
+				t.Fatalf("Parse(%s) error = %v", got.String(), err)
+			}
+			if again.String() != got.String() {
+				t.Errorf("Parse(%s) = %s, want %s", got.String(), again.String(), got.String())
+			}
+		})
+	}
+}
+
+func TestEval(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		entry *miniflux.Entry
+		want  bool
+	}{
+		{
+			name:  "Both sides of and match",
+			input: `title =~ "Sponsor" and description # "Bob"`,
+			entry: &miniflux.Entry{Title: "[Sponsor] Sun", Content: "by Bob"},
+			want:  true,
+		},
+		{
+			name:  "Only one side of and matches",
+			input: `title =~ "Sponsor" and description # "Bob"`,
+			entry: &miniflux.Entry{Title: "[Sponsor] Sun", Content: "by Alice"},
+			want:  false,
+		},
+		{
+			name:  "One side of or matches",
+			input: `(title # Moon) or (description =~ eclipse)`,
+			entry: &miniflux.Entry{Title: "Sun", Content: "solar eclipse"},
+			want:  true,
+		},
+		{
+			name:  "Negated contains",
+			input: `title !# Moon,Lunar`,
+			entry: &miniflux.Entry{Title: "Lunar eclipse"},
+			want:  false,
+		},
+		{
+			name:  "Negated regular expression",
+			input: `title !~ ^\[Sponsor\]`,
+			entry: &miniflux.Entry{Title: "Sun"},
+			want:  true,
+		},
+		{
+			name:  "Exact string equality",
+			input: `title = "Sun"`,
+			entry: &miniflux.Entry{Title: "Sunrise"},
+			want:  false,
+		},
+		{
+			name:  "String inequality",
+			input: `title != "Sun"`,
+			entry: &miniflux.Entry{Title: "Sunrise"},
+			want:  true,
+		},
+		{
+			name:  "Numeric text is compared as a number",
+			input: "title > 9",
+			entry: &miniflux.Entry{Title: "10"},
+			want:  true,
+		},
+		{
+			name:  "Other text is compared lexicographically",
+			input: "title < b",
+			entry: &miniflux.Entry{Title: "apple"},
+			want:  true,
+		},
+		{
+			name:  "Numeric text within range",
+			input: "title between 0:7",
+			entry: &miniflux.Entry{Title: "7"},
+			want:  true,
+		},
+		{
+			name:  "Text that isn't a number is never within a range",
+			input: "title between 0:7",
+			entry: &miniflux.Entry{Title: "five"},
+			want:  false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, err := Parse(tt.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := n.Eval(tt.entry); got != tt.want {
+				t.Errorf("Eval() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompare(t *testing.T) {
+	day := func(s string) value {
+		v, err := parseValue(kindDate, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+
+	tests := []struct {
+		name   string
+		a, b   value
+		want   int
+		wantOk bool
+	}{
+		{name: "Integers", a: intValue(2), b: intValue(10), want: -1, wantOk: true},
+		{name: "Integer and numeric text", a: intValue(10), b: stringValue("10"), want: 0, wantOk: true},
+		{name: "Integer and text", a: intValue(10), b: stringValue("ten"), wantOk: false},
+		{name: "Text", a: stringValue("b"), b: stringValue("a"), want: 1, wantOk: true},
+		{name: "Dates", a: day("2020-01-02"), b: day("2020-01-01T23:00:00Z"), want: 1, wantOk: true},
+		{name: "Date and integer", a: day("2020-01-02"), b: intValue(1), wantOk: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := compare(tt.a, tt.b)
+			if ok != tt.wantOk || got != tt.want {
+				t.Errorf("compare() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestParseRange(t *testing.T) {
+	lower, upper, err := parseRange(kindDate, "2020-01-01T00:00:00Z:2020-01-31")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lower.String() != "2020-01-01T00:00:00Z" || upper.String() != "2020-01-31T00:00:00Z" {
+		t.Errorf("parseRange() = %s, %s", lower, upper)
+	}
+}
+
+func TestAttributes(t *testing.T) {
+	defer func(fn func() time.Time) { now = fn }(now)
+	now = func() time.Time { return time.Date(2020, 7, 20, 12, 0, 0, 0, time.UTC) }
+
+	entry := &miniflux.Entry{
+		Title:   "Moon landing",
+		URL:     "https://example.com/moon",
+		Content: "<p>One small step</p>",
+		Author:  "Bob",
+		Starred: true,
+		Date:    time.Date(2020, 7, 15, 8, 0, 0, 0, time.UTC),
+		Enclosures: miniflux.Enclosures{
+			{URL: "https://example.com/moon.mp3", MimeType: "audio/mpeg"},
+		},
+		Feed: &miniflux.Feed{
+			Title:    "Example",
+			FeedURL:  "https://example.com/feed.xml",
+			Category: &miniflux.Category{Title: "Space"},
+		},
+	}
+
+	tests := []struct {
+		input string
+		want  bool
+	}{
+		{input: `content # "small step"`, want: true},
+		{input: `description # "small step"`, want: true},
+		{input: `author = Bob`, want: true},
+		{input: `link = "https://example.com/moon"`, want: true},
+		{input: `url =~ /moon$`, want: true},
+		{input: `feedtitle = Example`, want: true},
+		{input: `feedurl # feed.xml`, want: true},
+		{input: `category = Space`, want: true},
+		{input: `enclosure_url =~ \.mp3$`, want: true},
+		{input: `enclosure_type = "audio/mpeg"`, want: true},
+		{input: `starred = yes`, want: true},
+		{input: `pubDate > 2020-07-15`, want: true},
+		{input: `pubDate between 2020-07-01:2020-07-14`, want: false},
+		{input: `age = 5`, want: true},
+		{input: `age between 0:7`, want: true},
+		{input: `age > 7`, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			n, err := Parse(tt.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := n.Eval(entry); got != tt.want {
+				t.Errorf("Eval() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// Entries without a feed or enclosures don't match anything
+	n, err := Parse(`feedtitle = Example or category = Space or enclosure_type = "audio/mpeg"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.Eval(&miniflux.Entry{}) {
+		t.Errorf("Eval() = true, want false")
+	}
+}
+
+func TestMatch(t *testing.T) {
+	entry := &miniflux.Entry{Title: "A [Sponsor] post about the Moon", Author: "Bob"}
+
+	tests := []struct {
+		input string
+		want  Match
+	}{
+		{
+			input: `title =~ \[Sponsor\]`,
+			want:  Match{Attribute: "title", Operator: "=~", Value: `\[Sponsor\]`, Text: "[Sponsor]", Start: 2, End: 11},
+		},
+		{
+			input: `title # Lunar,Moon`,
+			want:  Match{Attribute: "title", Operator: "#", Value: "Lunar,Moon", Text: "Moon", Start: 27, End: 31},
+		},
+		{
+			input: `title # Sun or author = Bob`,
+			want:  Match{Attribute: "author", Operator: "=", Value: "Bob", Text: "Bob", Start: 0, End: 3},
+		},
+		{
+			input: `author = Bob and title # Moon`,
+			want:  Match{Attribute: "author", Operator: "=", Value: "Bob", Text: "Bob", Start: 0, End: 3},
+		},
+		{
+			input: `title !# Sun`,
+			want:  Match{Attribute: "title", Operator: "!#", Value: "Sun", Text: entry.Title, Start: 0, End: len(entry.Title)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			n, err := Parse(tt.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, ok := n.Match(entry)
+			if !ok {
+				t.Fatal("Match() = false, want true")
+			}
+			if got != tt.want {
+				t.Errorf("Match() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	n, err := Parse(`author = Bob and title # Sun`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := n.Match(entry); ok {
+		t.Error("Match() = true, want false")
+	}
+}
+
+func TestVolatile(t *testing.T) {
+	tests := []struct {
+		input string
+		want  bool
+	}{
+		{input: `title = Moon`, want: false},
+		{input: `age > 7`, want: true},
+		{input: `starred = yes`, want: true},
+		{input: `title = Moon and (author = Bob or age > 7)`, want: true},
+		{input: `title = Moon or pubDate > 2020-01-01`, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			node, err := Parse(tt.input)
+			if err != nil {
+				t.Fatalf("Parse(%q) returned error: %v", tt.input, err)
+			}
+			if got := Volatile(node); got != tt.want {
+				t.Errorf("Volatile(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package expr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// kind is the type of an attribute, it decides how values are compared
+type kind int
+
+const (
+	kindString kind = iota
+	kindInt
+	kindDate
+)
+
+func (k kind) String() string {
+	switch k {
+	case kindInt:
+		return "integer"
+	case kindDate:
+		return "date"
+	}
+	return "string"
+}
+
+// dateLayouts are the accepted formats for date values, the first one is used to print dates
+var dateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// value is a typed attribute value or literal
+type value struct {
+	kind kind
+	str  string
+	num  int64
+	date time.Time
+}
+
+func stringValue(s string) value {
+	return value{kind: kindString, str: s}
+}
+
+func intValue(n int64) value {
+	return value{kind: kindInt, num: n}
+}
+
+func dateValue(t time.Time) value {
+	return value{kind: kindDate, date: t}
+}
+
+// parseValue parses a literal from a filter expression as a value of the given kind
+func parseValue(k kind, s string) (value, error) {
+	switch k {
+	case kindInt:
+		n, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+		if err != nil {
+			return value{}, fmt.Errorf("%q is not an integer", s)
+		}
+		return intValue(n), nil
+	case kindDate:
+		for _, layout := range dateLayouts {
+			t, err := time.Parse(layout, strings.TrimSpace(s))
+			if err == nil {
+				return dateValue(t), nil
+			}
+		}
+		return value{}, fmt.Errorf("%q is not a date, use YYYY-MM-DD or RFC 3339", s)
+	}
+	return stringValue(s), nil
+}
+
+// parseRange parses the "<lower>:<upper>" argument of the between operator. As dates can contain colons
+// themselves every colon is tried until both sides are valid values.
+func parseRange(k kind, s string) (value, value, error) {
+	if k == kindString {
+		// Ranges on text attributes are compared numerically
+		k = kindInt
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] != ':' {
+			continue
+		}
+		lower, err := parseValue(k, s[:i])
+		if err != nil {
+			continue
+		}
+		upper, err := parseValue(k, s[i+1:])
+		if err != nil {
+			continue
+		}
+		if c, _ := compare(lower, upper); c > 0 {
+			return value{}, value{}, fmt.Errorf("lower bound of range %q is greater than the upper bound", s)
+		}
+		return lower, upper, nil
+	}
+	return value{}, value{}, fmt.Errorf("%q is not a valid %s range, use <lower>:<upper>", s, k)
+}
+
+func (v value) String() string {
+	switch v.kind {
+	case kindInt:
+		return strconv.FormatInt(v.num, 10)
+	case kindDate:
+		return v.date.Format(dateLayouts[0])
+	}
+	return v.str
+}
+
+// asInt returns the numeric representation of a value, text is only numeric if it's an integer
+func (v value) asInt() (int64, bool) {
+	switch v.kind {
+	case kindInt:
+		return v.num, true
+	case kindString:
+		n, err := strconv.ParseInt(strings.TrimSpace(v.str), 10, 64)
+		return n, err == nil
+	}
+	return 0, false
+}
+
+// compare returns -1, 0 or 1 if a is less than, equal to or greater than b. Numbers and dates are compared by their
+// value, text is compared numerically if both sides are integers and lexicographically otherwise. The second return
+// value is false if the values can't be compared.
+func compare(a, b value) (int, bool) {
+	if a.kind == kindDate || b.kind == kindDate {
+		if a.kind != b.kind {
+			return 0, false
+		}
+		switch {
+		case a.date.Before(b.date):
+			return -1, true
+		case a.date.After(b.date):
+			return 1, true
+		}
+		return 0, true
+	}
+	an, aok := a.asInt()
+	bn, bok := b.asInt()
+	if aok && bok {
+		switch {
+		case an < bn:
+			return -1, true
+		case an > bn:
+			return 1, true
+		}
+		return 0, true
+	}
+	if a.kind == kindInt || b.kind == kindInt {
+		return 0, false
+	}
+	return strings.Compare(a.str, b.str), true
+}
@@ -0,0 +1,18 @@
+package filter
+
+import "expvar"
+
+// Metrics of the filter job, they are published with expvar on /debug/vars
+var (
+	runsTotal       = expvar.NewInt("filter_runs_total")
+	runsSkipped     = expvar.NewInt("filter_runs_skipped_total")
+	lastRunDuration = expvar.NewFloat("filter_last_run_duration_seconds")
+	feedsProcessed  = expvar.NewInt("filter_feeds_processed_total")
+	feedErrors      = expvar.NewInt("filter_feed_errors_total")
+	entriesFetched  = expvar.NewInt("filter_entries_fetched_total")
+	// entriesMatched counts the matched entries by action
+	entriesMatched = expvar.NewMap("filter_entries_matched_total")
+
+	apiRetries       = expvar.NewInt("miniflux_retries_total")
+	apiCircuitOpened = expvar.NewInt("miniflux_circuit_opened_total")
+)
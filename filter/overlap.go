@@ -0,0 +1,50 @@
+package filter
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/go-kit/kit/log/level"
+)
+
+// OverlapPolicy decides what happens if a run of the filter job is started while the previous one is still running
+type OverlapPolicy string
+
+const (
+	// OverlapSkip skips the new run
+	OverlapSkip OverlapPolicy = "skip"
+	// OverlapQueue starts the new run once the previous one is done. Only one run is queued, further runs are skipped.
+	OverlapQueue OverlapPolicy = "queue"
+)
+
+// ParseOverlapPolicy returns the overlap policy with the given name
+func ParseOverlapPolicy(name string) (OverlapPolicy, error) {
+	switch p := OverlapPolicy(name); p {
+	case OverlapSkip, OverlapQueue:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown overlap policy %q, has to be %q or %q", name, OverlapSkip, OverlapQueue)
+}
+
+// acquire makes sure only one run of the filter job is in progress. It returns false if the run has to be skipped,
+// otherwise release has to be called once the run is done.
+func (s *service) acquire() bool {
+	select {
+	case s.running <- struct{}{}:
+		return true
+	default:
+	}
+	if s.cfg.OverlapPolicy == OverlapQueue && atomic.CompareAndSwapInt32(&s.queued, 0, 1) {
+		level.Info(s.l).Log("msg", "filter job is still running, queueing the next run")
+		s.running <- struct{}{}
+		atomic.StoreInt32(&s.queued, 0)
+		return true
+	}
+	runsSkipped.Add(1)
+	level.Warn(s.l).Log("msg", "filter job is still running, skipping this run", "overlap_policy", s.cfg.OverlapPolicy)
+	return false
+}
+
+func (s *service) release() {
+	<-s.running
+}
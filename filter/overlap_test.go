@@ -0,0 +1,103 @@
+package filter
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dewey/miniflux-sidekick/rules"
+	"github.com/go-kit/kit/log"
+	miniflux "miniflux.app/client"
+)
+
+func TestRunFilterJobOverlap(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   OverlapPolicy
+		wantRuns int32
+	}{
+		{name: "Skip", policy: OverlapSkip, wantRuns: 1},
+		{name: "Queue", policy: OverlapQueue, wantRuns: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				runs    int32
+				started = make(chan struct{}, 3)
+				unblock = make(chan struct{})
+			)
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				// With the feed strategy every run fetches the feeds once, the first run blocks until all other runs
+				// were started
+				atomic.AddInt32(&runs, 1)
+				started <- struct{}{}
+				<-unblock
+				json.NewEncoder(w).Encode(miniflux.Feeds{})
+			}))
+			defer srv.Close()
+
+			rr, err := rules.NewRepository(nil, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rr.SetCachedRules([]rules.Rule{{Command: "ignore-article", URL: "*", FilterExpression: "title = Moon"}})
+			s := NewService(log.NewNopLogger(), miniflux.New(srv.URL, "api-key"), rr, Config{OverlapPolicy: tt.policy, Strategy: StrategyFeed}).(*service)
+
+			skipped := runsSkipped.Value()
+			var wg sync.WaitGroup
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				s.RunFilterJob(false)
+			}()
+			<-started
+
+			// With the queue policy the second run waits, the third one is skipped as a run is queued already
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				s.RunFilterJob(false)
+			}()
+			go func() {
+				defer wg.Done()
+				s.RunFilterJob(false)
+			}()
+			for runsSkipped.Value()-skipped < 3-int64(tt.wantRuns) {
+				time.Sleep(time.Millisecond)
+			}
+			close(unblock)
+			wg.Wait()
+
+			if got := atomic.LoadInt32(&runs); got != tt.wantRuns {
+				t.Errorf("RunFilterJob() ran %d times, want %d", got, tt.wantRuns)
+			}
+			if got, want := runsSkipped.Value()-skipped, 3-int64(tt.wantRuns); got != want {
+				t.Errorf("RunFilterJob() skipped %d runs, want %d", got, want)
+			}
+		})
+	}
+}
+
+func TestParseOverlapPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    OverlapPolicy
+		wantErr bool
+	}{
+		{name: "skip", want: OverlapSkip},
+		{name: "queue", want: OverlapQueue},
+		{name: "parallel", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseOverlapPolicy(tt.name)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("ParseOverlapPolicy(%q) = %q, %v, want %q, error %v", tt.name, got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package filter
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// The pool is shared by goroutines, make test runs the tests with the race detector
+func TestForEach(t *testing.T) {
+	tests := []struct {
+		name    string
+		n       int
+		workers int
+	}{
+		{name: "More items than workers", n: 50, workers: 4},
+		{name: "More workers than items", n: 3, workers: 8},
+		{name: "Single worker", n: 10, workers: 1},
+		{name: "No items", n: 0, workers: 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				mutex         sync.Mutex
+				calls         = make(map[int]int)
+				running, peak int32
+			)
+			forEach(tt.n, tt.workers, func(i int) {
+				r := atomic.AddInt32(&running, 1)
+				defer atomic.AddInt32(&running, -1)
+				for {
+					p := atomic.LoadInt32(&peak)
+					if r <= p || atomic.CompareAndSwapInt32(&peak, p, r) {
+						break
+					}
+				}
+				time.Sleep(time.Millisecond)
+
+				mutex.Lock()
+				calls[i]++
+				mutex.Unlock()
+			})
+			if len(calls) != tt.n {
+				t.Errorf("forEach() called fn for %d indexes, want %d", len(calls), tt.n)
+			}
+			for i, c := range calls {
+				if c != 1 {
+					t.Errorf("forEach() called fn %d times for index %d, want 1", c, i)
+				}
+			}
+			if int(peak) > tt.workers {
+				t.Errorf("forEach() ran %d calls at the same time, want at most %d", peak, tt.workers)
+			}
+		})
+	}
+}
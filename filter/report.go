@@ -0,0 +1,97 @@
+package filter
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/dewey/miniflux-sidekick/rules"
+)
+
+// Report describes which entries a run of the filter job matched and what it did with them. In a simulation no
+// action is applied, the report shows what would happen.
+type Report struct {
+	Simulation bool          `json:"simulation"`
+	StartedAt  time.Time     `json:"started_at"`
+	FinishedAt time.Time     `json:"finished_at"`
+	Entries    []ReportEntry `json:"entries"`
+}
+
+// ReportEntry is an entry that matched a rule, with the action of the rule
+type ReportEntry struct {
+	FeedID    int64  `json:"feed_id"`
+	FeedTitle string `json:"feed_title"`
+	EntryID   int64  `json:"entry_id"`
+	Title     string `json:"title"`
+	URL       string `json:"url"`
+
+	Action rules.Action `json:"action"`
+	// Applied is set if the action was applied to the entry, it's never set in a simulation
+	Applied bool `json:"applied"`
+
+	Rule             string `json:"rule"`
+	RuleSource       string `json:"rule_source"`
+	RuleLine         int    `json:"rule_line"`
+	RuleOrigin       string `json:"rule_origin,omitempty"`
+	MatchedAttribute string `json:"matched_attribute"`
+	MatchedText      string `json:"matched_text"`
+}
+
+// add adds the matched entries of a feed to the report, in the order the actions are applied
+func (r *Report) add(fr feedResult) {
+	for _, action := range rules.Actions {
+		for _, me := range fr.matched[action] {
+			r.Entries = append(r.Entries, ReportEntry{
+				FeedID:           fr.feed.ID,
+				FeedTitle:        fr.feed.Title,
+				EntryID:          me.entry.ID,
+				Title:            me.entry.Title,
+				URL:              me.entry.URL,
+				Action:           action,
+				Applied:          !r.Simulation && !fr.failed[action][me.entry.ID],
+				Rule:             me.match.Rule.String(),
+				RuleSource:       me.match.Rule.Source,
+				RuleLine:         me.match.Rule.Line,
+				RuleOrigin:       me.match.Rule.Origin,
+				MatchedAttribute: me.match.Attribute,
+				MatchedText:      me.match.Text,
+			})
+		}
+	}
+}
+
+// WriteJSON writes the report as JSON
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// WriteText writes the report in a format for humans, with one line per entry followed by the rule that matched it
+func (r *Report) WriteText(w io.Writer) error {
+	kind := "run"
+	if r.Simulation {
+		kind = "simulation"
+	}
+	if _, err := fmt.Fprintf(w, "%s started at %s, %d matched entries\n", kind, r.StartedAt.Format(time.RFC3339), len(r.Entries)); err != nil {
+		return err
+	}
+	for _, e := range r.Entries {
+		status := "failed"
+		switch {
+		case r.Simulation:
+			status = "would " + actionDescription(e.Action)
+		case e.Applied:
+			status = actionDescription(e.Action)
+		}
+		location := fmt.Sprintf("%s:%d", e.RuleSource, e.RuleLine)
+		if e.RuleOrigin != "" && e.RuleOrigin != e.RuleSource {
+			location += " from " + e.RuleOrigin
+		}
+		if _, err := fmt.Fprintf(w, "%s: feed_id=%d feed=%q entry_id=%d title=%q url=%q\n\tby %s (%s) matched %s=%q\n", status, e.FeedID, e.FeedTitle, e.EntryID, e.Title, e.URL, location, e.Rule, e.MatchedAttribute, e.MatchedText); err != nil {
+			return err
+		}
+	}
+	return nil
+}
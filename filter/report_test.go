@@ -0,0 +1,156 @@
+package filter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dewey/miniflux-sidekick/minifluxtest"
+	"github.com/dewey/miniflux-sidekick/rules"
+	"github.com/go-kit/kit/log"
+	miniflux "miniflux.app/client"
+)
+
+func TestReport(t *testing.T) {
+	tests := []struct {
+		name       string
+		simulation bool
+		want       []ReportEntry
+	}{
+		{
+			name:       "Simulation",
+			simulation: true,
+			want: []ReportEntry{
+				{FeedID: 1, FeedTitle: "Example", EntryID: 2, Title: "Moon landing", URL: "https://example.com/2", Action: rules.ActionRead, Rule: `ignore-article "host:example.com" "title # Moon"`, RuleSource: "killfile", RuleLine: 1, MatchedAttribute: "title", MatchedText: "Moon"},
+				{FeedID: 1, FeedTitle: "Example", EntryID: 1, Title: "Sun", URL: "https://example.com/1", Action: rules.ActionStar, Rule: `star-article "host:example.com" "author = Bob"`, RuleSource: "killfile", RuleLine: 2, MatchedAttribute: "author", MatchedText: "Bob"},
+			},
+		},
+		{
+			name: "Destructive",
+			want: []ReportEntry{
+				{FeedID: 1, FeedTitle: "Example", EntryID: 2, Title: "Moon landing", URL: "https://example.com/2", Action: rules.ActionRead, Applied: true, Rule: `ignore-article "host:example.com" "title # Moon"`, RuleSource: "killfile", RuleLine: 1, MatchedAttribute: "title", MatchedText: "Moon"},
+				{FeedID: 1, FeedTitle: "Example", EntryID: 1, Title: "Sun", URL: "https://example.com/1", Action: rules.ActionStar, Applied: true, Rule: `star-article "host:example.com" "author = Bob"`, RuleSource: "killfile", RuleLine: 2, MatchedAttribute: "author", MatchedText: "Bob"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := minifluxtest.NewClient()
+			client.AddFeeds(&miniflux.Feed{ID: 1, Title: "Example", FeedURL: "https://example.com/feed.xml"})
+			client.AddEntries(
+				&miniflux.Entry{ID: 1, FeedID: 1, Title: "Sun", URL: "https://example.com/1", Author: "Bob"},
+				&miniflux.Entry{ID: 2, FeedID: 1, Title: "Moon landing", URL: "https://example.com/2"},
+			)
+			rr, err := rules.NewRepository(nil, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rr.SetCachedRules([]rules.Rule{
+				{Command: "ignore-article", URL: "host:example.com", FilterExpression: "title # Moon", Source: "killfile", Line: 1},
+				{Command: "star-article", URL: "host:example.com", FilterExpression: "author = Bob", Source: "killfile", Line: 2},
+			})
+			s := NewService(log.NewNopLogger(), client, rr, Config{})
+			if s.LastReport() != nil {
+				t.Errorf("LastReport() before the first run = %v, want nil", s.LastReport())
+			}
+
+			s.RunFilterJob(tt.simulation)
+			report := s.LastReport()
+			if report == nil {
+				t.Fatal("LastReport() = nil, want report")
+			}
+			if report.Simulation != tt.simulation || !reflect.DeepEqual(report.Entries, tt.want) {
+				t.Errorf("LastReport() = %+v, want simulation %v and entries %+v", report, tt.simulation, tt.want)
+			}
+		})
+	}
+}
+
+func TestReportPartiallyApplied(t *testing.T) {
+	client := minifluxtest.NewClient()
+	client.AddFeeds(&miniflux.Feed{ID: 1, Title: "Example", FeedURL: "https://example.com/feed.xml"})
+	for id := int64(1); id <= 25; id++ {
+		entry := &miniflux.Entry{ID: id, FeedID: 1, Title: fmt.Sprintf("Moon %d", id)}
+		if id <= 2 {
+			entry.Author = "Bob"
+		}
+		client.AddEntries(entry)
+	}
+	rr, err := rules.NewRepository(nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr.SetCachedRules([]rules.Rule{
+		{Command: "ignore-article", URL: "host:example.com", FilterExpression: "title # Moon"},
+		{Command: "star-article", URL: "host:example.com", FilterExpression: "author = Bob"},
+	})
+
+	// All attempts of the first batch of status updates and the first bookmark fail, the other entries are updated
+	client.FailNext("UpdateEntries", miniflux.ErrServerError, miniflux.ErrServerError, miniflux.ErrServerError)
+	client.FailNext("ToggleBookmark", miniflux.ErrServerError)
+	now := time.Now()
+	c := newTestResilientClient(client, ResilienceConfig{Attempts: 3, FailureThreshold: 10}, &now)
+	s := NewService(log.NewNopLogger(), c, rr, Config{BatchSize: 10})
+	s.RunFilterJob(false)
+
+	var applied int
+	for _, e := range s.LastReport().Entries {
+		want := client.Status(e.EntryID) == miniflux.EntryStatusRead
+		if e.Action == rules.ActionStar {
+			want = client.Starred(e.EntryID)
+		}
+		if e.Applied != want {
+			t.Errorf("LastReport() entry %d with action %s applied = %v, want %v", e.EntryID, e.Action, e.Applied, want)
+		}
+		if e.Applied {
+			applied++
+		}
+	}
+	if applied != 16 {
+		t.Errorf("LastReport() has %d applied entries, want 16", applied)
+	}
+}
+
+func TestReportWrite(t *testing.T) {
+	report := &Report{
+		Simulation: true,
+		StartedAt:  time.Date(2020, 7, 20, 12, 0, 0, 0, time.UTC),
+		FinishedAt: time.Date(2020, 7, 20, 12, 0, 1, 0, time.UTC),
+		Entries: []ReportEntry{
+			{FeedID: 1, FeedTitle: "xkcd", EntryID: 7, Title: "Lunar Eclipse", URL: "https://xkcd.com/7", Action: rules.ActionRead, Rule: `ignore-article "https://xkcd.com/atom.xml" "title # Lunar,Moon"`, RuleSource: "./killfile", RuleLine: 2, MatchedAttribute: "title", MatchedText: "Lunar"},
+			{FeedID: 2, FeedTitle: "Example", EntryID: 9, Title: "Sponsored", URL: "https://example.com/9", Action: rules.ActionRead, Rule: `ignore-article "*" "title =~ Sponsor"`, RuleSource: "https://example.com/killfile", RuleLine: 1, RuleOrigin: "community", MatchedAttribute: "title", MatchedText: "Sponsor"},
+		},
+	}
+
+	var text bytes.Buffer
+	if err := report.WriteText(&text); err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Join([]string{
+		`simulation started at 2020-07-20T12:00:00Z, 2 matched entries`,
+		`would set status to read: feed_id=1 feed="xkcd" entry_id=7 title="Lunar Eclipse" url="https://xkcd.com/7"`,
+		`	by ./killfile:2 (ignore-article "https://xkcd.com/atom.xml" "title # Lunar,Moon") matched title="Lunar"`,
+		`would set status to read: feed_id=2 feed="Example" entry_id=9 title="Sponsored" url="https://example.com/9"`,
+		`	by https://example.com/killfile:1 from community (ignore-article "*" "title =~ Sponsor") matched title="Sponsor"`,
+		``,
+	}, "\n")
+	if text.String() != want {
+		t.Errorf("WriteText() = %q, want %q", text.String(), want)
+	}
+
+	var b bytes.Buffer
+	if err := report.WriteJSON(&b); err != nil {
+		t.Fatal(err)
+	}
+	var decoded Report
+	if err := json.Unmarshal(b.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&decoded, report) {
+		t.Errorf("WriteJSON() = %s, want %+v", b.String(), report)
+	}
+}
@@ -0,0 +1,225 @@
+package filter
+
+import (
+	"errors"
+	"math/rand"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	miniflux "miniflux.app/client"
+)
+
+// ErrCircuitOpen is returned instead of calling Miniflux while it's considered to be down
+var ErrCircuitOpen = errors.New("miniflux is unavailable, not sending requests until the cooldown is over")
+
+// ResilienceConfig contains the settings of the resilient client
+type ResilienceConfig struct {
+	// Attempts is how often a request that failed with a transient error is sent
+	Attempts int
+	// BaseDelay is the delay before the first retry, it's doubled for every further retry up to MaxDelay. The actual
+	// delay is a random duration up to that value so clients don't retry in lockstep.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// FailureThreshold is the number of failed requests in a row after which no requests are sent for Cooldown
+	FailureThreshold int
+	Cooldown         time.Duration
+}
+
+// DefaultResilienceConfig is used for settings that aren't configured
+var DefaultResilienceConfig = ResilienceConfig{
+	Attempts:         3,
+	BaseDelay:        500 * time.Millisecond,
+	MaxDelay:         10 * time.Second,
+	FailureThreshold: 5,
+	Cooldown:         time.Minute,
+}
+
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+// resilientClient retries requests that failed with a transient error and stops sending requests for a while if
+// Miniflux seems to be down. Only requests that can safely be sent twice are retried, setting the status of entries
+// again doesn't change anything but toggling a bookmark twice would undo it.
+type resilientClient struct {
+	client Client
+	l      log.Logger
+	cfg    ResilienceConfig
+
+	mutex    sync.Mutex
+	state    circuitState
+	failures int
+	openedAt time.Time
+
+	// now and sleep are replaced in tests
+	now   func() time.Time
+	sleep func(time.Duration)
+}
+
+// NewResilientClient wraps a client with retries and a circuit breaker
+func NewResilientClient(c Client, l log.Logger, cfg ResilienceConfig) Client {
+	if cfg.Attempts <= 0 {
+		cfg.Attempts = DefaultResilienceConfig.Attempts
+	}
+	if cfg.BaseDelay <= 0 {
+		cfg.BaseDelay = DefaultResilienceConfig.BaseDelay
+	}
+	if cfg.MaxDelay <= 0 {
+		cfg.MaxDelay = DefaultResilienceConfig.MaxDelay
+	}
+	if cfg.FailureThreshold <= 0 {
+		cfg.FailureThreshold = DefaultResilienceConfig.FailureThreshold
+	}
+	if cfg.Cooldown <= 0 {
+		cfg.Cooldown = DefaultResilienceConfig.Cooldown
+	}
+	return &resilientClient{
+		client: c,
+		l:      l,
+		cfg:    cfg,
+		now:    time.Now,
+		sleep:  time.Sleep,
+	}
+}
+
+func (c *resilientClient) Categories() (miniflux.Categories, error) {
+	var categories miniflux.Categories
+	err := c.retry("Categories", func() (err error) {
+		categories, err = c.client.Categories()
+		return err
+	})
+	return categories, err
+}
+
+func (c *resilientClient) Feeds() (miniflux.Feeds, error) {
+	var feeds miniflux.Feeds
+	err := c.retry("Feeds", func() (err error) {
+		feeds, err = c.client.Feeds()
+		return err
+	})
+	return feeds, err
+}
+
+func (c *resilientClient) Entries(filter *miniflux.Filter) (*miniflux.EntryResultSet, error) {
+	var result *miniflux.EntryResultSet
+	err := c.retry("Entries", func() (err error) {
+		result, err = c.client.Entries(filter)
+		return err
+	})
+	return result, err
+}
+
+func (c *resilientClient) FeedEntries(feedID int64, filter *miniflux.Filter) (*miniflux.EntryResultSet, error) {
+	var result *miniflux.EntryResultSet
+	err := c.retry("FeedEntries", func() (err error) {
+		result, err = c.client.FeedEntries(feedID, filter)
+		return err
+	})
+	return result, err
+}
+
+func (c *resilientClient) UpdateEntries(entryIDs []int64, status string) error {
+	return c.retry("UpdateEntries", func() error {
+		return c.client.UpdateEntries(entryIDs, status)
+	})
+}
+
+func (c *resilientClient) ToggleBookmark(entryID int64) error {
+	return c.call(func() error {
+		return c.client.ToggleBookmark(entryID)
+	})
+}
+
+// retry sends a request until it succeeds, fails with an error that isn't transient or all attempts are used up
+func (c *resilientClient) retry(name string, fn func() error) error {
+	var err error
+	for attempt := 1; attempt <= c.cfg.Attempts; attempt++ {
+		if err = c.call(fn); err == nil || err == ErrCircuitOpen || !transient(err) {
+			return err
+		}
+		if attempt < c.cfg.Attempts {
+			delay := c.backoff(attempt)
+			apiRetries.Add(1)
+			level.Warn(c.l).Log("msg", "request to miniflux failed, retrying", "request", name, "attempt", attempt, "delay", delay, "err", err)
+			c.sleep(delay)
+		}
+	}
+	return err
+}
+
+// backoff returns a random delay up to the base delay doubled for every attempt
+func (c *resilientClient) backoff(attempt int) time.Duration {
+	max := c.cfg.BaseDelay
+	for i := 1; i < attempt && max < c.cfg.MaxDelay; i++ {
+		max *= 2
+	}
+	if max > c.cfg.MaxDelay {
+		max = c.cfg.MaxDelay
+	}
+	return time.Duration(rand.Int63n(int64(max)) + 1)
+}
+
+// call sends a request unless the circuit is open. Once the cooldown is over a single request is let through, if it
+// succeeds the circuit is closed again.
+func (c *resilientClient) call(fn func() error) error {
+	c.mutex.Lock()
+	switch c.state {
+	case circuitOpen:
+		if c.now().Sub(c.openedAt) < c.cfg.Cooldown {
+			c.mutex.Unlock()
+			return ErrCircuitOpen
+		}
+		c.state = circuitHalfOpen
+	case circuitHalfOpen:
+		// Another request is checking if Miniflux is back
+		c.mutex.Unlock()
+		return ErrCircuitOpen
+	}
+	c.mutex.Unlock()
+
+	err := fn()
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if err != nil && transient(err) {
+		c.failures++
+		if c.state == circuitHalfOpen || c.failures >= c.cfg.FailureThreshold {
+			if c.state != circuitOpen {
+				apiCircuitOpened.Add(1)
+				level.Error(c.l).Log("msg", "miniflux seems to be down, pausing requests", "failures", c.failures, "cooldown", c.cfg.Cooldown, "err", err)
+			}
+			c.state = circuitOpen
+			c.openedAt = c.now()
+		}
+		return err
+	}
+	if c.state == circuitHalfOpen {
+		level.Info(c.l).Log("msg", "miniflux is reachable again, resuming requests")
+	}
+	c.state = circuitClosed
+	c.failures = 0
+	return err
+}
+
+// transient reports whether a request might succeed if it's sent again, like after a timeout or a server error
+func transient(err error) bool {
+	switch err {
+	case miniflux.ErrServerError:
+		return true
+	case miniflux.ErrNotAuthorized, miniflux.ErrForbidden, miniflux.ErrNotFound, ErrCircuitOpen:
+		return false
+	}
+	if _, ok := err.(net.Error); ok {
+		return true
+	}
+	// The client doesn't have errors for other status codes, like a 502 while Miniflux is restarting
+	return strings.HasPrefix(err.Error(), "miniflux: status code=5")
+}
@@ -0,0 +1,179 @@
+package filter
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/dewey/miniflux-sidekick/minifluxtest"
+	"github.com/dewey/miniflux-sidekick/rules"
+	"github.com/go-kit/kit/log"
+	miniflux "miniflux.app/client"
+)
+
+// newTestResilientClient returns a resilient client that doesn't sleep and uses the given clock
+func newTestResilientClient(c Client, cfg ResilienceConfig, now *time.Time) *resilientClient {
+	rc := NewResilientClient(c, log.NewNopLogger(), cfg).(*resilientClient)
+	rc.sleep = func(time.Duration) {}
+	rc.now = func() time.Time { return *now }
+	return rc
+}
+
+func TestResilientClientRetry(t *testing.T) {
+	tests := []struct {
+		name      string
+		method    string
+		errs      []error
+		wantErr   error
+		wantCalls int
+	}{
+		{name: "Success", method: "Feeds", wantCalls: 1},
+		{name: "Transient errors are retried", method: "Feeds", errs: []error{miniflux.ErrServerError, miniflux.ErrServerError}, wantCalls: 3},
+		{name: "All attempts fail", method: "FeedEntries", errs: []error{miniflux.ErrServerError, miniflux.ErrServerError, miniflux.ErrServerError}, wantErr: miniflux.ErrServerError, wantCalls: 3},
+		{name: "Status updates are retried", method: "UpdateEntries", errs: []error{miniflux.ErrServerError}, wantCalls: 2},
+		{name: "Other errors aren't retried", method: "Entries", errs: []error{miniflux.ErrNotAuthorized}, wantErr: miniflux.ErrNotAuthorized, wantCalls: 1},
+		{name: "Bookmarks aren't retried", method: "ToggleBookmark", errs: []error{miniflux.ErrServerError}, wantErr: miniflux.ErrServerError, wantCalls: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := minifluxtest.NewClient()
+			fake.AddEntries(&miniflux.Entry{ID: 1, FeedID: 1})
+			fake.FailNext(tt.method, tt.errs...)
+			now := time.Now()
+			c := newTestResilientClient(fake, ResilienceConfig{Attempts: 3, FailureThreshold: 10}, &now)
+
+			var err error
+			switch tt.method {
+			case "Feeds":
+				_, err = c.Feeds()
+			case "FeedEntries":
+				_, err = c.FeedEntries(1, nil)
+			case "Entries":
+				_, err = c.Entries(nil)
+			case "UpdateEntries":
+				err = c.UpdateEntries([]int64{1}, miniflux.EntryStatusRead)
+			case "ToggleBookmark":
+				err = c.ToggleBookmark(1)
+			}
+			if err != tt.wantErr {
+				t.Errorf("%s() = %v, want %v", tt.method, err, tt.wantErr)
+			}
+			if got := fake.Calls(tt.method); got != tt.wantCalls {
+				t.Errorf("%s() sent %d requests, want %d", tt.method, got, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestResilientClientBackoff(t *testing.T) {
+	c := NewResilientClient(nil, log.NewNopLogger(), ResilienceConfig{BaseDelay: time.Second, MaxDelay: 5 * time.Second}).(*resilientClient)
+	tests := []struct {
+		attempt int
+		max     time.Duration
+	}{
+		{attempt: 1, max: time.Second},
+		{attempt: 2, max: 2 * time.Second},
+		{attempt: 3, max: 4 * time.Second},
+		{attempt: 4, max: 5 * time.Second},
+		{attempt: 10, max: 5 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.attempt), func(t *testing.T) {
+			for i := 0; i < 100; i++ {
+				if got := c.backoff(tt.attempt); got <= 0 || got > tt.max {
+					t.Fatalf("backoff(%d) = %v, want between 0 and %v", tt.attempt, got, tt.max)
+				}
+			}
+		})
+	}
+}
+
+func TestResilientClientCircuit(t *testing.T) {
+	fake := minifluxtest.NewClient()
+	now := time.Date(2020, 7, 20, 12, 0, 0, 0, time.UTC)
+	c := newTestResilientClient(fake, ResilienceConfig{Attempts: 1, FailureThreshold: 2, Cooldown: time.Minute}, &now)
+
+	steps := []struct {
+		name      string
+		advance   time.Duration
+		errs      []error
+		wantErr   error
+		wantCalls int
+	}{
+		{name: "First failure", errs: []error{miniflux.ErrServerError}, wantErr: miniflux.ErrServerError, wantCalls: 1},
+		{name: "Second failure opens the circuit", errs: []error{miniflux.ErrServerError}, wantErr: miniflux.ErrServerError, wantCalls: 2},
+		{name: "Open circuit", advance: 30 * time.Second, wantErr: ErrCircuitOpen, wantCalls: 2},
+		{name: "Failed request after the cooldown opens it again", advance: 30 * time.Second, errs: []error{miniflux.ErrServerError}, wantErr: miniflux.ErrServerError, wantCalls: 3},
+		{name: "Open circuit again", advance: 59 * time.Second, wantErr: ErrCircuitOpen, wantCalls: 3},
+		{name: "Successful request after the cooldown closes it", advance: time.Second, wantCalls: 4},
+		{name: "Closed circuit", wantCalls: 5},
+	}
+	for _, step := range steps {
+		now = now.Add(step.advance)
+		fake.FailNext("Feeds", step.errs...)
+		if _, err := c.Feeds(); err != step.wantErr {
+			t.Errorf("%s: Feeds() = %v, want %v", step.name, err, step.wantErr)
+		}
+		if got := fake.Calls("Feeds"); got != step.wantCalls {
+			t.Errorf("%s: sent %d requests, want %d", step.name, got, step.wantCalls)
+		}
+	}
+}
+
+func TestTransient(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "Server error", err: miniflux.ErrServerError, want: true},
+		{name: "Bad gateway", err: errors.New("miniflux: status code=502"), want: true},
+		{name: "Connection refused", err: &url.Error{Op: "Get", URL: "http://miniflux", Err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}}, want: true},
+		{name: "Not authorized", err: miniflux.ErrNotAuthorized, want: false},
+		{name: "Not found", err: miniflux.ErrNotFound, want: false},
+		{name: "Bad request", err: errors.New("miniflux: bad request (invalid status)"), want: false},
+		{name: "Circuit open", err: ErrCircuitOpen, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := transient(tt.err); got != tt.want {
+				t.Errorf("transient(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunFilterJobPausedWhileMinifluxIsDown(t *testing.T) {
+	fake := minifluxtest.NewClient()
+	fake.AddFeeds(&miniflux.Feed{ID: 1, FeedURL: "https://example.com/feed.xml"})
+	fake.AddEntries(&miniflux.Entry{ID: 1, FeedID: 1, Title: "Moon"})
+	now := time.Date(2020, 7, 20, 12, 0, 0, 0, time.UTC)
+	c := newTestResilientClient(fake, ResilienceConfig{Attempts: 2, FailureThreshold: 2, Cooldown: time.Minute}, &now)
+
+	rr, err := rules.NewRepository(nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr.SetCachedRules([]rules.Rule{{Command: "ignore-article", URL: "host:example.com", FilterExpression: "title = Moon"}})
+	s := NewService(log.NewNopLogger(), c, rr, Config{})
+
+	// Miniflux is down for both attempts of the first run, the second run doesn't send any requests
+	fake.FailNext("Feeds", miniflux.ErrServerError, miniflux.ErrServerError)
+	s.RunFilterJob(false)
+	s.RunFilterJob(false)
+	if got := fake.Calls("Feeds"); got != 2 {
+		t.Errorf("RunFilterJob() sent %d requests while miniflux was down, want 2", got)
+	}
+	if got := fake.Status(1); got != miniflux.EntryStatusUnread {
+		t.Errorf("RunFilterJob() entry has status %q while miniflux was down, want %q", got, miniflux.EntryStatusUnread)
+	}
+
+	now = now.Add(time.Minute)
+	s.RunFilterJob(false)
+	if got := fake.Status(1); got != miniflux.EntryStatusRead {
+		t.Errorf("RunFilterJob() entry has status %q after miniflux is back, want %q", got, miniflux.EntryStatusRead)
+	}
+}
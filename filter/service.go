@@ -1,8 +1,13 @@
 package filter
 
 import (
-	"regexp"
+	"fmt"
+	"reflect"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/dewey/miniflux-sidekick/rules"
 	"github.com/go-kit/kit/log"
@@ -14,20 +19,149 @@ import (
 type Service interface {
 	RunFilterJob(simulation bool)
 	Run()
+
+	// EvaluateEntry checks an entry against the current rules. It returns which actions apply to the entry and why.
+	EvaluateEntry(entry *miniflux.Entry) Result
+
+	// LastReport returns the report of the last run, or nil if there wasn't a run yet
+	LastReport() *Report
+}
+
+// Result is the outcome of evaluating an entry against the rules
+type Result struct {
+	// Matches contains the first matching rule for every action that applies to the entry, in the order the actions
+	// are applied
+	Matches []Match
+
+	// Keep explains the keep rule that protects the entry, if there is one
+	Keep *Match
+}
+
+// Killed reports whether the entry is marked as read or removed
+func (r Result) Killed() bool {
+	for _, m := range r.Matches {
+		if m.Action.Kills() {
+			return true
+		}
+	}
+	return false
+}
+
+// Match explains which rule matched an entry
+type Match struct {
+	// RuleIndex is the position of the rule in the rule set
+	RuleIndex int
+	Rule      rules.Rule
+	Action    rules.Action
+
+	// Attribute is the attribute of the entry that matched and Text the part of it that matched. Start and End are the
+	// byte offsets of Text in the attribute.
+	Attribute  string
+	Text       string
+	Start, End int
+}
+
+// logValues returns the match as key value pairs for logging
+func (m Match) logValues() []interface{} {
+	return []interface{}{
+		"action", m.Action,
+		"rule_index", m.RuleIndex,
+		"rule_source", m.Rule.Source,
+		"rule_line", m.Rule.Line,
+		"rule", m.Rule,
+		"matched_attribute", m.Attribute,
+		"matched_text", m.Text,
+		"matched_span", fmt.Sprintf("%d:%d", m.Start, m.End),
+	}
+}
+
+// matchedEntry is an entry together with the rule that matched it
+type matchedEntry struct {
+	entry *miniflux.Entry
+	match Match
+}
+
+// Config contains the settings of the filter job
+type Config struct {
+	// PageSize is the number of entries fetched from Miniflux per request
+	PageSize int
+	// MaxEntriesPerRun limits the number of entries fetched in one run to protect the Miniflux server, zero disables
+	// the limit
+	MaxEntriesPerRun int
+	// Concurrency is the number of feeds that are processed at the same time
+	Concurrency int
+	// BatchSize is the maximum number of entries updated with one request
+	BatchSize int
+	// StateStore keeps the last evaluated entry of every feed, so a run only fetches entries that were added since the
+	// previous run. The state is kept in memory if it's not set.
+	StateStore StateStore
+	// Strategy decides how the unread entries are fetched, it's chosen based on the rules if it's not set
+	Strategy Strategy
+	// OverlapPolicy decides what happens if a run is started while the previous one is still running, runs are skipped
+	// if it's not set
+	OverlapPolicy OverlapPolicy
+}
+
+// DefaultPageSize is used if no page size is configured
+const DefaultPageSize = 100
+
+// DefaultConcurrency is used if no concurrency is configured
+const DefaultConcurrency = 4
+
+// DefaultBatchSize is used if no batch size is configured
+const DefaultBatchSize = 100
+
+// Client contains the calls of the Miniflux API the filter service uses, it's implemented by *miniflux.Client and by
+// the in-memory client of the minifluxtest package
+type Client interface {
+	Categories() (miniflux.Categories, error)
+	Feeds() (miniflux.Feeds, error)
+	Entries(filter *miniflux.Filter) (*miniflux.EntryResultSet, error)
+	FeedEntries(feedID int64, filter *miniflux.Filter) (*miniflux.EntryResultSet, error)
+	UpdateEntries(entryIDs []int64, status string) error
+	ToggleBookmark(entryID int64) error
 }
 
 type service struct {
-	rulesRepository  rules.Repository
-	client *miniflux.Client
-	l      log.Logger
+	rulesRepository rules.Repository
+	client          Client
+	l               log.Logger
+	cfg             Config
+
+	// report holds the *Report of the last run
+	report atomic.Value
+
+	// running holds a token while a run is in progress, queued is set while a run waits for it
+	running chan struct{}
+	queued  int32
 }
 
 // NewService initializes a new filter service
-func NewService(l log.Logger, c *miniflux.Client, rr rules.Repository) Service {
+func NewService(l log.Logger, c Client, rr rules.Repository, cfg Config) Service {
+	if cfg.PageSize <= 0 {
+		cfg.PageSize = DefaultPageSize
+	}
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = DefaultConcurrency
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = DefaultBatchSize
+	}
+	if cfg.StateStore == nil {
+		cfg.StateStore = NewMemoryStateStore()
+	}
+	if cfg.Strategy == "" {
+		cfg.Strategy = StrategyAuto
+	}
+	if cfg.OverlapPolicy == "" {
+		cfg.OverlapPolicy = OverlapSkip
+	}
 	return &service{
-		rulesRepository:  rr,
-		client: c,
-		l:      l,
+		rulesRepository: rr,
+		client:          c,
+		l:               l,
+		cfg:             cfg,
+		running:         make(chan struct{}, 1),
 	}
 }
 
@@ -35,118 +169,612 @@ func (s *service) Run() {
 	s.RunFilterJob(false)
 }
 
-var filterEntryRegex = regexp.MustCompile(`(\w+?) (\S+?) (.+)`)
+// LastReport returns the report of the last run
+func (s *service) LastReport() *Report {
+	report, _ := s.report.Load().(*Report)
+	return report
+}
 
+// RunFilterJob runs the filter job, there's never more than one run in progress at the same time
 func (s *service) RunFilterJob(simulation bool) {
+	if !s.acquire() {
+		return
+	}
+	defer s.release()
+
+	report := &Report{
+		Simulation: simulation,
+		StartedAt:  time.Now(),
+		Entries:    []ReportEntry{},
+	}
+	defer func() {
+		report.FinishedAt = time.Now()
+		s.report.Store(report)
+		runsTotal.Add(1)
+		lastRunDuration.Set(report.FinishedAt.Sub(report.StartedAt).Seconds())
+	}()
+
+	// The rule set is compiled once and used for the whole run, even if the rules are refreshed in the meantime
+	rs := s.rulesRepository.RuleSet()
+	for _, ir := range rs.Invalid() {
+		level.Error(s.l).Log("err", "invalid filter expression", "expression", ir.FilterExpression, "reason", ir.Err)
+	}
+	rs, ok := s.resolveCategories(rs)
+	if !ok {
+		return
+	}
+
+	state := s.loadState(rs)
+	if !simulation {
+		// A simulation doesn't change any entries, so the next run has to evaluate them again
+		defer func() {
+			if err := s.cfg.StateStore.Save(state); err != nil {
+				level.Error(s.l).Log("msg", "error on saving the filter state", "err", err)
+			}
+		}()
+	}
+
+	var (
+		results     []feedResult
+		lastEntryID int64
+		global      = s.strategy(rs) == StrategyGlobal
+	)
+	var fingerprints map[int64]string
+	if global {
+		var after int64
+		if !rs.Volatile() {
+			// The rules that apply to a feed can change without a change of the rules, like if the feed is moved to
+			// another category. The shared high-water mark only holds if that didn't happen for any of the feeds.
+			var ok bool
+			if fingerprints, ok = s.fingerprintFeeds(rs); !ok {
+				return
+			}
+			after = state.LastEntryID
+			if after > 0 && !reflect.DeepEqual(fingerprints, state.FeedRules) {
+				level.Info(s.l).Log("msg", "the rules of some feeds changed since the last run, evaluating all unread entries")
+				after = 0
+			}
+		}
+		results, lastEntryID = s.processAllFeeds(rs, after, simulation)
+	} else {
+		results = s.processFeeds(rs, state, simulation)
+	}
+
+	// The feeds are processed concurrently, the results are logged in the order of the feeds afterwards so the logs
+	// of a run don't depend on which feed was the fastest
+	var skipped, paused, failed int
+	for _, r := range results {
+		if r.skipped {
+			skipped++
+			continue
+		}
+		if r.err == ErrCircuitOpen {
+			paused++
+			failed++
+			continue
+		}
+		s.logFeedResult(r, simulation)
+		report.add(r)
+		if r.err != nil || len(r.failed) > 0 {
+			failed++
+			continue
+		}
+		if len(r.entries) > 0 {
+			state.LastEntryIDs[r.feed.ID] = r.entries[len(r.entries)-1].ID
+			state.FeedRules[r.feed.ID] = fingerprint(rs, r.feed)
+		}
+	}
+	if skipped > 0 {
+		level.Warn(s.l).Log("msg", "reached the maximum number of entries per run, skipping remaining feeds", "max_entries_per_run", s.cfg.MaxEntriesPerRun, "skipped_feeds", skipped)
+	}
+	if paused > 0 {
+		level.Warn(s.l).Log("msg", "miniflux is unavailable, skipping remaining feeds until the next run", "skipped_feeds", paused)
+	}
+	// The entries of all feeds share one high-water mark, it can only move on if all of them were processed
+	if global && failed == 0 {
+		state.LastEntryID = lastEntryID
+		if fingerprints != nil {
+			state.FeedRules = fingerprints
+		}
+	}
+}
+
+// fingerprintFeeds fetches all feeds and returns the fingerprints of the feeds that match one of the rules
+func (s *service) fingerprintFeeds(rs *rules.RuleSet) (map[int64]string, bool) {
+	feeds, err := s.client.Feeds()
+	if err == ErrCircuitOpen {
+		level.Warn(s.l).Log("msg", "miniflux is unavailable, skipping this run")
+		return nil, false
+	}
+	if err != nil {
+		level.Error(s.l).Log("err", err)
+		return nil, false
+	}
+	fingerprints := make(map[int64]string)
+	for _, feed := range feeds {
+		if fp := fingerprint(rs, feed); fp != "" {
+			fingerprints[feed.ID] = fp
+		}
+	}
+	return fingerprints, true
+}
+
+// fingerprint identifies the rules that apply to a feed, it's empty if no rule applies to it
+func fingerprint(rs *rules.RuleSet, feed *miniflux.Feed) string {
+	var indices []string
+	for _, rule := range rs.Compiled() {
+		if rule.MatchesFeed(feed) {
+			indices = append(indices, strconv.Itoa(rule.Index))
+		}
+	}
+	return strings.Join(indices, ",")
+}
+
+// resolveCategories resolves the category blocks of the rules against the categories Miniflux has right now, so the
+// feeds added to a category are filtered without changing the killfile
+func (s *service) resolveCategories(rs *rules.RuleSet) (*rules.RuleSet, bool) {
+	if !rs.Scoped() {
+		return rs, true
+	}
+	categories, err := s.client.Categories()
+	if err == ErrCircuitOpen {
+		level.Warn(s.l).Log("msg", "miniflux is unavailable, skipping this run")
+		return nil, false
+	}
+	if err != nil {
+		level.Error(s.l).Log("msg", "error on fetching the categories, skipping this run", "err", err)
+		return nil, false
+	}
+	resolved, errs := rs.Resolve(categories)
+	for _, err := range errs {
+		level.Warn(s.l).Log("msg", "the rules of a category block don't match any feed", "err", err)
+	}
+	return resolved, true
+}
+
+// processFeeds fetches and processes the unread entries of every feed that matches one of the rules, feed by feed
+func (s *service) processFeeds(rs *rules.RuleSet, state State, simulation bool) []feedResult {
 	// Fetch all feeds.
 	f, err := s.client.Feeds()
+	if err == ErrCircuitOpen {
+		level.Warn(s.l).Log("msg", "miniflux is unavailable, skipping this run")
+		return nil
+	}
 	if err != nil {
 		level.Error(s.l).Log("err", err)
-		return
+		return nil
 	}
+
+	var feeds []*miniflux.Feed
 	for _, feed := range f {
-		// Check if the feed matches one of our rules
-		var found bool
-		for _, rule := range s.rulesRepository.Rules() {
-			// Also support the wildcard selector
-			if rule.URL == "*" {
-				found = true
+		if selected(rs, feed) {
+			feeds = append(feeds, feed)
+		}
+	}
+
+	results := make([]feedResult, len(feeds))
+	budget := newEntryBudget(s.cfg.MaxEntriesPerRun)
+	forEach(len(feeds), s.cfg.Concurrency, func(i int) {
+		// Entries up to the last evaluated one were checked against the same rules already. That's not true for rules
+		// with attributes like the age of an entry, or if other rules apply to the feed now, like after it was moved
+		// to another category. All unread entries of the feed are evaluated again then.
+		var after int64
+		if !rs.Volatile() && state.FeedRules[feeds[i].ID] == fingerprint(rs, feeds[i]) {
+			after = state.LastEntryIDs[feeds[i].ID]
+		}
+		results[i] = s.processFeed(rs, feeds[i], after, budget, simulation)
+	})
+	return results
+}
+
+// processAllFeeds fetches the unread entries of all feeds at once, routes them to their feeds and processes the feeds
+// that match one of the rules. It returns the ID of the last fetched entry.
+func (s *service) processAllFeeds(rs *rules.RuleSet, after int64, simulation bool) ([]feedResult, int64) {
+	entries, err := s.fetchAllUnreadEntries(after, newEntryBudget(s.cfg.MaxEntriesPerRun))
+	if err == ErrCircuitOpen && len(entries) == 0 {
+		level.Warn(s.l).Log("msg", "miniflux is unavailable, skipping this run")
+		return nil, after
+	}
+	if err != nil {
+		level.Error(s.l).Log("msg", "error on fetching the unread entries, continuing with the fetched entries", "err", err)
+	}
+	entriesFetched.Add(int64(len(entries)))
+
+	// The feeds are processed in the order of their first entry
+	var (
+		feeds   []*miniflux.Feed
+		byFeed  = make(map[int64][]*miniflux.Entry)
+		checked = make(map[int64]bool)
+	)
+	for _, entry := range entries {
+		if entry.Feed == nil {
+			continue
+		}
+		if !checked[entry.FeedID] {
+			checked[entry.FeedID] = true
+			if selected(rs, entry.Feed) {
+				feeds = append(feeds, entry.Feed)
 			}
-			if strings.Contains(feed.FeedURL, rule.URL) {
-				found = true
+		}
+		byFeed[entry.FeedID] = append(byFeed[entry.FeedID], entry)
+	}
+
+	results := make([]feedResult, len(feeds))
+	forEach(len(feeds), s.cfg.Concurrency, func(i int) {
+		results[i] = s.processEntries(rs, feeds[i], byFeed[feeds[i].ID], simulation)
+	})
+	if len(entries) == 0 {
+		return results, after
+	}
+	return results, entries[len(entries)-1].ID
+}
+
+// selected checks if the feed matches one of our rules, keep rules alone don't do anything
+func selected(rs *rules.RuleSet, feed *miniflux.Feed) bool {
+	for _, rule := range rs.Compiled() {
+		if rule.Command != rules.CommandKeepArticle && rule.MatchesFeed(feed) {
+			return true
+		}
+	}
+	return false
+}
+
+// feedResult is the outcome of processing a feed
+type feedResult struct {
+	feed    *miniflux.Feed
+	entries []*miniflux.Entry
+	results []Result
+
+	// matched contains the matched entries for every action
+	matched map[rules.Action][]matchedEntry
+	// applied contains the actions that were applied to all matched entries, failed contains the IDs of the entries
+	// an action couldn't be applied to
+	applied []rules.Action
+	failed  map[rules.Action]map[int64]bool
+
+	// skipped is set if the feed wasn't processed because the maximum number of entries per run was reached
+	skipped bool
+	err     error
+}
+
+// processFeed fetches the unread entries of a feed after the given entry ID and processes them
+func (s *service) processFeed(rs *rules.RuleSet, feed *miniflux.Feed, after int64, budget *entryBudget, simulation bool) feedResult {
+	if budget.exhausted() {
+		return feedResult{feed: feed, skipped: true}
+	}
+
+	// We then get all the unread entries of the feed that matches our rule
+	entries, err := s.fetchUnreadEntries(feed.ID, after, budget)
+	entriesFetched.Add(int64(len(entries)))
+	if err != nil {
+		return feedResult{feed: feed, err: err}
+	}
+	return s.processEntries(rs, feed, entries, simulation)
+}
+
+// processEntries checks which rules match the entries of a feed and applies the actions. It's called concurrently for
+// different feeds and doesn't log the matches, that's done by logFeedResult.
+func (s *service) processEntries(rs *rules.RuleSet, feed *miniflux.Feed, entries []*miniflux.Entry, simulation bool) feedResult {
+	r := feedResult{
+		feed:    feed,
+		entries: entries,
+		matched: make(map[rules.Action][]matchedEntry),
+	}
+
+	// We then check which rules match the entry and collect the entries for every action, e.g. if it matches an
+	// ignore rule we set it to "read" so we don't see it any more
+	r.results = make([]Result, len(r.entries))
+	for i, entry := range r.entries {
+		if entry.Feed == nil {
+			entry.Feed = feed
+		}
+		r.results[i] = s.evaluateRules(rs, entry)
+		for _, m := range r.results[i].Matches {
+			r.matched[m.Action] = append(r.matched[m.Action], matchedEntry{entry: entry, match: m})
+		}
+	}
+
+	for _, action := range rules.Actions {
+		if len(r.matched[action]) == 0 {
+			continue
+		}
+		if simulation {
+			continue
+		}
+		if failed := s.apply(action, r.matched[action]); len(failed) > 0 {
+			if r.failed == nil {
+				r.failed = make(map[rules.Action]map[int64]bool)
 			}
+			r.failed[action] = failed
+			continue
+		}
+		r.applied = append(r.applied, action)
+	}
+	return r
+}
+
+// logFeedResult logs the matches and the applied actions of a feed and updates the metrics
+func (s *service) logFeedResult(r feedResult, simulation bool) {
+	feedsProcessed.Add(1)
+	for i, result := range r.results {
+		entry := r.entries[i]
+		if result.Keep != nil {
+			level.Info(s.l).Log(append([]interface{}{"msg", "entry is protected by a keep rule", "entry_id", entry.ID, "feed_id", r.feed.ID}, result.Keep.logValues()...)...)
+		}
+		for _, m := range result.Matches {
+			level.Info(s.l).Log(append([]interface{}{"msg", "entry matches rules in the killfile", "entry_id", entry.ID, "feed_id", r.feed.ID}, m.logValues()...)...)
 		}
-		if !found {
+	}
+	if r.err != nil {
+		feedErrors.Add(1)
+		level.Error(s.l).Log("err", r.err, "feed_id", r.feed.ID)
+		return
+	}
+	for _, action := range rules.Actions {
+		entriesMatched.Add(string(action), int64(len(r.matched[action])))
+		if !simulation {
 			continue
 		}
+		for _, me := range r.matched[action] {
+			level.Info(s.l).Log(append([]interface{}{"msg", "would " + actionDescription(action), "entry_id", me.entry.ID, "entry_title", me.entry.Title}, me.match.logValues()...)...)
+		}
+	}
+	for _, action := range r.applied {
+		level.Info(s.l).Log("msg", "applied action to all matched feed items", "action", action, "affected", len(r.matched[action]), "feed_id", r.feed.ID)
+	}
+	for _, action := range rules.Actions {
+		if len(r.failed[action]) == 0 {
+			continue
+		}
+		// The entries the action failed for are still unread, they are picked up again by the next run
+		feedErrors.Add(1)
+		level.Warn(s.l).Log("msg", "action couldn't be applied to all matched feed items", "action", action, "failed", len(r.failed[action]), "affected", len(r.matched[action]), "feed_id", r.feed.ID)
+	}
+}
+
+// loadState returns the state of the previous run. If the rules changed since then all unread entries have to be
+// evaluated again, so the state is reset.
+func (s *service) loadState(rs *rules.RuleSet) State {
+	state, err := s.cfg.StateStore.Load()
+	if err != nil {
+		level.Error(s.l).Log("msg", "error on loading the filter state, evaluating all unread entries", "err", err)
+		state = State{}
+	}
+	if state.RulesChecksum != rs.Checksum() {
+		if state.RulesChecksum != "" {
+			level.Info(s.l).Log("msg", "rules changed since the last run, evaluating all unread entries")
+		}
+		state = State{RulesChecksum: rs.Checksum()}
+	}
+	if state.LastEntryIDs == nil {
+		state.LastEntryIDs = make(map[int64]int64)
+	}
+	if state.FeedRules == nil {
+		state.FeedRules = make(map[int64]string)
+	}
+	return state
+}
+
+// fetchUnreadEntries walks through all pages of unread entries of a feed with an ID greater than after, oldest first.
+// It stops once the entry budget of the run is used up.
+func (s *service) fetchUnreadEntries(feedID int64, after int64, budget *entryBudget) ([]*miniflux.Entry, error) {
+	return s.fetchPages(func(f *miniflux.Filter) (*miniflux.EntryResultSet, error) {
+		return s.client.FeedEntries(feedID, f)
+	}, after, budget, "feed_id", feedID)
+}
+
+// fetchAllUnreadEntries is like fetchUnreadEntries for the unread entries of all feeds
+func (s *service) fetchAllUnreadEntries(after int64, budget *entryBudget) ([]*miniflux.Entry, error) {
+	return s.fetchPages(s.client.Entries, after, budget)
+}
 
-		// We then get all the unread entries of the feed that matches our rule
-		entries, err := s.client.FeedEntries(feed.ID, &miniflux.Filter{
-			Status: miniflux.EntryStatusUnread,
+// fetchPages walks through all pages of unread entries with an ID greater than after. Pages are requested by entry ID
+// so marking entries as read in the meantime doesn't shift them. The key value pairs are added to log messages.
+func (s *service) fetchPages(fetch func(*miniflux.Filter) (*miniflux.EntryResultSet, error), after int64, budget *entryBudget, keyvals ...interface{}) ([]*miniflux.Entry, error) {
+	var (
+		entries []*miniflux.Entry
+		total   = -1
+	)
+	for {
+		pageSize := budget.take(s.cfg.PageSize)
+		if pageSize == 0 {
+			break
+		}
+		page, err := fetch(&miniflux.Filter{
+			Status:       miniflux.EntryStatusUnread,
+			Order:        "id",
+			Direction:    "asc",
+			Limit:        pageSize,
+			AfterEntryID: after,
 		})
 		if err != nil {
-			level.Error(s.l).Log("err", err)
-			continue
+			budget.giveBack(pageSize)
+			return entries, err
+		}
+		budget.giveBack(pageSize - len(page.Entries))
+		if total < 0 {
+			total = page.Total
+		}
+		entries = append(entries, page.Entries...)
+		if len(page.Entries) < pageSize || len(entries) >= total {
+			break
 		}
+		after = page.Entries[len(page.Entries)-1].ID
+	}
+	if len(entries) < total {
+		level.Warn(s.l).Log(append([]interface{}{"msg", "not all unread entries were fetched", "fetched", len(entries), "total", total}, keyvals...)...)
+	}
+	return entries, nil
+}
 
-		// We then check if the entry title matches a rule, if it matches we set it to "read" so we don't see it any more
-		var matchedEntries []int64
-		for _, entry := range entries.Entries {
-			if s.evaluateRules(entry) {
-				level.Info(s.l).Log("msg", "entry matches rules in the killfile", "entry_id", entry.ID, "feed_id", feed.ID)
-				matchedEntries = append(matchedEntries, entry.ID)
-			}
+// entryBudget limits the number of entries fetched in one run, it's shared by all workers of the run
+type entryBudget struct {
+	mutex     sync.Mutex
+	remaining int
+	unlimited bool
+}
+
+// newEntryBudget returns a budget of max entries, zero means no limit
+func newEntryBudget(max int) *entryBudget {
+	return &entryBudget{
+		remaining: max,
+		unlimited: max <= 0,
+	}
+}
+
+// take reserves up to n entries and returns how many were reserved
+func (b *entryBudget) take(n int) int {
+	if b.unlimited {
+		return n
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if n > b.remaining {
+		n = b.remaining
+	}
+	b.remaining -= n
+	return n
+}
+
+// giveBack returns reserved entries that weren't fetched
+func (b *entryBudget) giveBack(n int) {
+	if b.unlimited {
+		return
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.remaining += n
+}
+
+func (b *entryBudget) exhausted() bool {
+	if b.unlimited {
+		return false
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.remaining <= 0
+}
+
+// actionDescription describes an action for log messages
+func actionDescription(action rules.Action) string {
+	switch action {
+	case rules.ActionRead:
+		return "set status to read"
+	case rules.ActionRemove:
+		return "set status to removed"
+	case rules.ActionStar:
+		return "star entry"
+	}
+	return "report entry"
+}
+
+// apply executes an action for the matched entries. Status updates are sent in batches of the configured size, if a
+// batch fails the remaining batches are still sent. Failed requests are retried by the resilient client. It returns the
+// IDs of the entries the action couldn't be applied to.
+func (s *service) apply(action rules.Action, matched []matchedEntry) map[int64]bool {
+	failed := make(map[int64]bool)
+	switch action {
+	case rules.ActionRead, rules.ActionRemove:
+		status := miniflux.EntryStatusRead
+		if action == rules.ActionRemove {
+			status = miniflux.EntryStatusRemoved
 		}
-		if simulation {
-			for _, me := range matchedEntries {
-				e, err := s.client.Entry(me)
-				if err != nil {
-					level.Error(s.l).Log("err", err)
-					return
-				}
-				level.Info(s.l).Log("msg", "would set status to read", "entry_id", me, "entry_title", e.Title)
+		for start := 0; start < len(matched); start += s.cfg.BatchSize {
+			end := start + s.cfg.BatchSize
+			if end > len(matched) {
+				end = len(matched)
+			}
+			ids := make([]int64, 0, end-start)
+			for _, me := range matched[start:end] {
+				ids = append(ids, me.entry.ID)
 			}
-		} else {
-			for _, me := range matchedEntries {
-				level.Info(s.l).Log("msg", "set status to read", "entry_id", me)
-				if err := s.client.UpdateEntries([]int64{me}, miniflux.EntryStatusRead); err != nil {
-					level.Error(s.l).Log("msg", "error on updating the feed entries", "ids", me, "err", err)
-					return
+			level.Info(s.l).Log("msg", actionDescription(action), "ids", fmt.Sprint(ids))
+			if err := s.client.UpdateEntries(ids, status); err != nil {
+				level.Error(s.l).Log("msg", "error on updating the feed entries", "ids", fmt.Sprint(ids), "action", action, "err", err)
+				for _, id := range ids {
+					failed[id] = true
 				}
 			}
 		}
-		if len(matchedEntries) > 0 {
-			level.Info(s.l).Log("msg", "marked all matched feed items as read", "affected", len(matchedEntries))
+	case rules.ActionStar:
+		for _, me := range matched {
+			// The API can only toggle the bookmark, entries that are starred already have to stay starred. It's not
+			// retried as the bookmark might have been toggled even if the request failed.
+			if me.entry.Starred {
+				continue
+			}
+			level.Info(s.l).Log("msg", actionDescription(action), "entry_id", me.entry.ID)
+			if err := s.client.ToggleBookmark(me.entry.ID); err != nil {
+				level.Error(s.l).Log("msg", "error on starring the feed entry", "entry_id", me.entry.ID, "err", err)
+				failed[me.entry.ID] = true
+			}
 		}
 	}
+	// Reported entries are only logged
+	return failed
 }
 
-// evaluateRules checks a feed items against the available rules. It returns wheater this entry should be killed or not.
-func (s service) evaluateRules(entry *miniflux.Entry) bool {
-	var shouldKill bool
-	for _, rule := range s.rulesRepository.Rules() {
-		tokens := filterEntryRegex.FindStringSubmatch(rule.FilterExpression)
-		if tokens == nil || len(tokens) != 4 {
-			level.Error(s.l).Log("err", "invalid filter expression", "expression", rule.FilterExpression)
+// EvaluateEntry checks an entry against the current rules. It returns which actions apply to the entry and why.
+func (s *service) EvaluateEntry(entry *miniflux.Entry) Result {
+	return s.evaluateRules(s.rulesRepository.RuleSet(), entry)
+}
+
+// evaluateRules checks a feed items against the rules for its feed, rules for other feeds are ignored. It returns the
+// first matching rule of every action. Keep rules for the feed of the entry take precedence over all rules that mark
+// entries as read or removed, no matter in which order they are defined. An entry that is removed isn't marked as read
+// as well.
+func (s service) evaluateRules(rs *rules.RuleSet, entry *miniflux.Entry) Result {
+	var result Result
+	for _, rule := range rs.Compiled() {
+		if rule.Command == rules.CommandKeepArticle && rule.MatchesFeed(entry.Feed) && rule.Expression.Eval(entry) {
+			m := newMatch(rule, "", entry)
+			result.Keep = &m
+			break
+		}
+	}
+
+	var matches []Match
+	for _, rule := range rs.Compiled() {
+		action, ok := rule.Action()
+		if !ok || action.Kills() && result.Keep != nil || hasAction(matches, action) || !rule.MatchesFeed(entry.Feed) {
 			continue
 		}
-		// We set the string we want to compare against (https://newsboat.org/releases/2.15/docs/newsboat.html#_filter_language are supported in the killfile format)
-		var entryTarget string
-		switch tokens[1] {
-		case "title":
-			entryTarget = entry.Title
-		case "description":
-			entryTarget = entry.Content
+		if rule.Expression.Eval(entry) {
+			matches = append(matches, newMatch(rule, action, entry))
 		}
-
-		// We check what kind of comparator was given
-		switch tokens[2] {
-		case "=~", "!~":
-			invertFilter := tokens[2][0] == '!'
-
-			matched, err := regexp.MatchString(tokens[3], entryTarget)
-			if err != nil {
-				level.Error(s.l).Log("err", err)
+	}
+	for _, action := range rules.Actions {
+		if action == rules.ActionRead && hasAction(matches, rules.ActionRemove) {
+			continue
+		}
+		for _, m := range matches {
+			if m.Action == action {
+				result.Matches = append(result.Matches, m)
 			}
+		}
+	}
+	return result
+}
 
-			if matched && !invertFilter || !matched && invertFilter {
-				shouldKill = true
-			}
-		case "#", "!#":
-			invertFilter := tokens[2][0] == '!'
-
-			var containsTerm bool
-			blacklistTokens := strings.Split(tokens[3], ",")
-			for _, t := range blacklistTokens {
-				if strings.Contains(entryTarget, t) {
-					containsTerm = true
-					break
-				}
-			}
-			if containsTerm && !invertFilter || !containsTerm && invertFilter {
-				shouldKill = true
-			}
+func hasAction(matches []Match, action rules.Action) bool {
+	for _, m := range matches {
+		if m.Action == action {
+			return true
 		}
 	}
-	return shouldKill
+	return false
+}
+
+// newMatch explains why an entry matched a rule
+func newMatch(rule rules.CompiledRule, action rules.Action, entry *miniflux.Entry) Match {
+	m, _ := rule.Expression.Match(entry)
+	return Match{
+		RuleIndex: rule.Index,
+		Rule:      rule.Rule,
+		Action:    action,
+		Attribute: m.Attribute,
+		Text:      m.Text,
+		Start:     m.Start,
+		End:       m.End,
+	}
 }
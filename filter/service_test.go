@@ -1,30 +1,43 @@
 package filter
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dewey/miniflux-sidekick/expr"
+	"github.com/dewey/miniflux-sidekick/minifluxtest"
 	"github.com/dewey/miniflux-sidekick/rules"
 	"github.com/go-kit/kit/log"
 	miniflux "miniflux.app/client"
-	"testing"
 )
 
 func TestEvaluateRules(t *testing.T) {
 	type mockService struct {
-		rules  []rules.Rule
-		l      log.Logger
+		rules []rules.Rule
+		l     log.Logger
 	}
 
 	tests := []struct {
-		name   string
+		name  string
 		rules []rules.Rule
-		args   *miniflux.Entry
-		want   bool
+		args  *miniflux.Entry
+		want  bool
 	}{
 		{
 			name: "Entry contains string",
 			rules: []rules.Rule{
 				{
-					Command: "ignore-article",
-					URL: "http://example.com/feed.xml",
+					Command:          "ignore-article",
+					URL:              "http://example.com/feed.xml",
 					FilterExpression: "title # Moon",
 				},
 			},
@@ -37,8 +50,8 @@ func TestEvaluateRules(t *testing.T) {
 			name: "Entry contains string",
 			rules: []rules.Rule{
 				{
-					Command: "ignore-article",
-					URL: "http://example.com/feed.xml",
+					Command:          "ignore-article",
+					URL:              "http://example.com/feed.xml",
 					FilterExpression: "title # Moon",
 				},
 			},
@@ -51,8 +64,8 @@ func TestEvaluateRules(t *testing.T) {
 			name: "Entry contains string, matched with Regexp",
 			rules: []rules.Rule{
 				{
-					Command: "ignore-article",
-					URL: "http://example.com/feed.xml",
+					Command:          "ignore-article",
+					URL:              "http://example.com/feed.xml",
 					FilterExpression: "title =~ [Sponsor]",
 				},
 			},
@@ -65,8 +78,8 @@ func TestEvaluateRules(t *testing.T) {
 			name: "Entry doesn't string, matched with Regexp",
 			rules: []rules.Rule{
 				{
-					Command: "ignore-article",
-					URL: "http://example.com/feed.xml",
+					Command:          "ignore-article",
+					URL:              "http://example.com/feed.xml",
 					FilterExpression: `title =~ \[Sponsor\]`,
 				},
 			},
@@ -79,8 +92,8 @@ func TestEvaluateRules(t *testing.T) {
 			name: "Entry doesn't string, matched with Regexp, ignore case",
 			rules: []rules.Rule{
 				{
-					Command: "ignore-article",
-					URL: "http://example.com/feed.xml",
+					Command:          "ignore-article",
+					URL:              "http://example.com/feed.xml",
 					FilterExpression: "title =~ (?i)(Podcast|scooter)",
 				},
 			},
@@ -93,8 +106,8 @@ func TestEvaluateRules(t *testing.T) {
 			name: "Entry doesn't string, matched with Regexp, ignore case",
 			rules: []rules.Rule{
 				{
-					Command: "ignore-article",
-					URL: "http://example.com/feed.xml",
+					Command:          "ignore-article",
+					URL:              "http://example.com/feed.xml",
 					FilterExpression: "title =~ (?i)(Podcast|scooter)",
 				},
 			},
@@ -107,8 +120,8 @@ func TestEvaluateRules(t *testing.T) {
 			name: "Entry doesn't string, matched with Regexp, respect case",
 			rules: []rules.Rule{
 				{
-					Command: "ignore-article",
-					URL: "http://example.com/feed.xml",
+					Command:          "ignore-article",
+					URL:              "http://example.com/feed.xml",
 					FilterExpression: "title =~ (Podcast)",
 				},
 			},
@@ -117,21 +130,901 @@ func TestEvaluateRules(t *testing.T) {
 			},
 			want: false,
 		},
+		{
+			name: "Entry matches both conditions of a compound expression",
+			rules: []rules.Rule{
+				{
+					Command:          "ignore-article",
+					URL:              "http://example.com/feed.xml",
+					FilterExpression: `title =~ "Sponsor" and description # "Bob"`,
+				},
+			},
+			args: &miniflux.Entry{
+				Title:   "[Sponsor] Sun entry",
+				Content: "Written by Bob",
+			},
+			want: true,
+		},
+		{
+			name: "Entry matches only one condition of a compound expression",
+			rules: []rules.Rule{
+				{
+					Command:          "ignore-article",
+					URL:              "http://example.com/feed.xml",
+					FilterExpression: `title =~ "Sponsor" and description # "Bob"`,
+				},
+			},
+			args: &miniflux.Entry{
+				Title:   "[Sponsor] Sun entry",
+				Content: "Written by Alice",
+			},
+			want: false,
+		},
+		{
+			name: "Keep rule overrides an earlier ignore rule",
+			rules: []rules.Rule{
+				{
+					Command:          "ignore-article",
+					URL:              "*",
+					FilterExpression: "title # Moon",
+				},
+				{
+					Command:          "keep-article",
+					URL:              "http://example.com/feed.xml",
+					FilterExpression: "author = Bob",
+				},
+			},
+			args: &miniflux.Entry{
+				Title:  "Moon entry",
+				Author: "Bob",
+				Feed:   &miniflux.Feed{FeedURL: "http://example.com/feed.xml"},
+			},
+			want: false,
+		},
+		{
+			name: "Keep rule only applies to its own feed",
+			rules: []rules.Rule{
+				{
+					Command:          "keep-article",
+					URL:              "http://example.com/feed.xml",
+					FilterExpression: "author = Bob",
+				},
+				{
+					Command:          "ignore-article",
+					URL:              "*",
+					FilterExpression: "title # Moon",
+				},
+			},
+			args: &miniflux.Entry{
+				Title:  "Moon entry",
+				Author: "Bob",
+				Feed:   &miniflux.Feed{FeedURL: "http://example.org/feed.xml"},
+			},
+			want: true,
+		},
+		{
+			name: "Keep rule that doesn't match the entry",
+			rules: []rules.Rule{
+				{
+					Command:          "keep-article",
+					URL:              "*",
+					FilterExpression: "author = Bob",
+				},
+				{
+					Command:          "ignore-article",
+					URL:              "*",
+					FilterExpression: "title # Moon",
+				},
+			},
+			args: &miniflux.Entry{
+				Title:  "Moon entry",
+				Author: "Alice",
+			},
+			want: true,
+		},
+		{
+			name: "Entry of another feed",
+			rules: []rules.Rule{
+				{
+					Command:          "ignore-article",
+					URL:              "http://example.com/feed.xml",
+					FilterExpression: "title # Moon",
+				},
+			},
+			args: &miniflux.Entry{
+				Title: "Moon entry",
+				Feed:  &miniflux.Feed{FeedURL: "https://xkcd.com/atom.xml"},
+			},
+			want: false,
+		},
+		{
+			name: "Entry of another feed matched by a wildcard rule",
+			rules: []rules.Rule{
+				{
+					Command:          "ignore-article",
+					URL:              "*",
+					FilterExpression: "title # Moon",
+				},
+			},
+			args: &miniflux.Entry{
+				Title: "Moon entry",
+				Feed:  &miniflux.Feed{FeedURL: "https://xkcd.com/atom.xml"},
+			},
+			want: true,
+		},
+		{
+			name: "Entry matches one side of a parenthesized or",
+			rules: []rules.Rule{
+				{
+					Command:          "ignore-article",
+					URL:              "http://example.com/feed.xml",
+					FilterExpression: "(title # Moon) or (description =~ eclipse)",
+				},
+			},
+			args: &miniflux.Entry{
+				Title:   "Sun entry",
+				Content: "There will be an eclipse",
+			},
+			want: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			localMockRepository, err := rules.NewLocalRepository()
+			localMockRepository, err := rules.NewRepository(nil, false)
 			if err != nil {
 				t.Fatal(err)
 			}
 
 			s := service{
-				rulesRepository:  localMockRepository,
+				rulesRepository: localMockRepository,
+			}
+			// Unless the test is about another feed the entry belongs to the feed of the rules
+			if tt.args.Feed == nil {
+				tt.args.Feed = &miniflux.Feed{FeedURL: "http://example.com/feed.xml"}
 			}
 			s.rulesRepository.SetCachedRules(tt.rules)
-			if got := s.evaluateRules(tt.args); got != tt.want {
+			if got := s.evaluateRules(s.rulesRepository.RuleSet(), tt.args).Killed(); got != tt.want {
 				t.Errorf("evaluateRules() = %v, want %v", got, tt.want)
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+
+// benchmarkRules returns a killfile sized rule set with a mix of regular expressions and term lists. None of them
+// match the benchmark entry so every rule has to be evaluated.
+func benchmarkRules(n int) []rules.Rule {
+	var rs []rules.Rule
+	for i := 0; i < n; i++ {
+		expression := fmt.Sprintf(`title =~ (?i)(sponsor|podcast)%d`, i)
+		if i%2 == 0 {
+			expression = fmt.Sprintf("title # Lunar%d,Moon%d or description # eclipse%d", i, i, i)
+		}
+		rs = append(rs, rules.Rule{
+			Command:          "ignore-article",
+			URL:              "*",
+			FilterExpression: expression,
+		})
+	}
+	return rs
+}
+
+var benchmarkEntry = &miniflux.Entry{
+	Title:   "A perfectly normal entry about the sun",
+	Content: "Some content that doesn't match any of the rules",
+}
+
+func BenchmarkEvaluateRules(b *testing.B) {
+	localMockRepository, err := rules.NewRepository(nil, false)
+	if err != nil {
+		b.Fatal(err)
+	}
+	localMockRepository.SetCachedRules(benchmarkRules(300))
+	s := service{
+		rulesRepository: localMockRepository,
+	}
+	rs := s.rulesRepository.RuleSet()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s.evaluateRules(rs, benchmarkEntry)
+	}
+}
+
+// BenchmarkEvaluateRulesReparse parses every filter expression for every entry, like the filter job did before rules
+// were compiled once per rule set. It's the baseline for BenchmarkEvaluateRules.
+func BenchmarkEvaluateRulesReparse(b *testing.B) {
+	rs := benchmarkRules(300)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, rule := range rs {
+			node, err := expr.Parse(rule.FilterExpression)
+			if err != nil {
+				b.Fatal(err)
+			}
+			node.Eval(benchmarkEntry)
+		}
+	}
+}
+
+func TestEvaluateRulesMatch(t *testing.T) {
+	localMockRepository, err := rules.NewRepository(nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	localMockRepository.SetCachedRules([]rules.Rule{
+		{
+			Command:          "ignore-article",
+			URL:              "*",
+			FilterExpression: "title # Sun",
+			Source:           "killfile",
+			Line:             1,
+		},
+		{
+			Command:          "ignore-article",
+			URL:              "http://example.com/feed.xml",
+			FilterExpression: `title =~ \[Sponsor\]`,
+			Source:           "killfile",
+			Line:             2,
+		},
+	})
+	s := service{
+		rulesRepository: localMockRepository,
+	}
+
+	result := s.EvaluateEntry(&miniflux.Entry{Title: "A [Sponsor] post", Feed: &miniflux.Feed{FeedURL: "http://example.com/feed.xml"}})
+	if len(result.Matches) != 1 {
+		t.Fatalf("EvaluateEntry() = %+v, want 1 match", result)
+	}
+	want := Match{
+		RuleIndex: 1,
+		Rule:      localMockRepository.Rules()[1],
+		Action:    rules.ActionRead,
+		Attribute: "title",
+		Text:      "[Sponsor]",
+		Start:     2,
+		End:       11,
+	}
+	if result.Matches[0] != want {
+		t.Errorf("EvaluateEntry() = %+v, want %+v", result.Matches[0], want)
+	}
+}
+
+func TestEvaluateRulesActions(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules []rules.Rule
+		want  []rules.Action
+	}{
+		{
+			name: "Removing takes precedence over marking as read",
+			rules: []rules.Rule{
+				{Command: "ignore-article", URL: "*", FilterExpression: "title # Moon"},
+				{Command: "remove-article", URL: "*", FilterExpression: "author = Bob"},
+			},
+			want: []rules.Action{rules.ActionRemove},
+		},
+		{
+			name: "Starring and reporting are independent of marking as read",
+			rules: []rules.Rule{
+				{Command: "report-article", URL: "*", FilterExpression: "title # Moon"},
+				{Command: "ignore-article", URL: "*", FilterExpression: "title # Moon"},
+				{Command: "star-article", URL: "*", FilterExpression: "author = Bob"},
+			},
+			want: []rules.Action{rules.ActionRead, rules.ActionStar, rules.ActionReport},
+		},
+		{
+			name: "Keep rules don't prevent starring",
+			rules: []rules.Rule{
+				{Command: "ignore-article", URL: "*", FilterExpression: "title # Moon"},
+				{Command: "star-article", URL: "*", FilterExpression: "title # Moon"},
+				{Command: "keep-article", URL: "*", FilterExpression: "author = Bob"},
+			},
+			want: []rules.Action{rules.ActionStar},
+		},
+		{
+			name: "Only the first rule of an action is reported",
+			rules: []rules.Rule{
+				{Command: "ignore-article", URL: "*", FilterExpression: "title # Moon"},
+				{Command: "ignore-article", URL: "*", FilterExpression: "author = Bob"},
+			},
+			want: []rules.Action{rules.ActionRead},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			localMockRepository, err := rules.NewRepository(nil, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			localMockRepository.SetCachedRules(tt.rules)
+			s := service{
+				rulesRepository: localMockRepository,
+			}
+
+			var got []rules.Action
+			for _, m := range s.EvaluateEntry(&miniflux.Entry{Title: "Moon entry", Author: "Bob"}).Matches {
+				got = append(got, m.Action)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("EvaluateEntry() actions = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFetchUnreadEntries(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path != "/v1/feeds/1/entries" || r.URL.Query().Get("order") != "id" || r.URL.Query().Get("direction") != "asc" {
+			t.Errorf("unexpected request %s", r.URL)
+		}
+		after, _ := strconv.ParseInt(r.URL.Query().Get("after_entry_id"), 10, 64)
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+
+		// The feed has 250 unread entries with the IDs 1 to 250
+		result := miniflux.EntryResultSet{Total: 250 - int(after)}
+		for id := after + 1; id <= 250 && len(result.Entries) < limit; id++ {
+			result.Entries = append(result.Entries, &miniflux.Entry{ID: id})
+		}
+		json.NewEncoder(w).Encode(result)
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name         string
+		after        int64
+		limit        int
+		wantEntries  int
+		wantRequests int
+	}{
+		{name: "All pages", limit: 0, wantEntries: 250, wantRequests: 3},
+		{name: "Limited", limit: 120, wantEntries: 120, wantRequests: 2},
+		{name: "After the last evaluated entry", after: 200, limit: 0, wantEntries: 50, wantRequests: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests = 0
+			s := NewService(log.NewNopLogger(), miniflux.New(srv.URL, "api-key"), nil, Config{PageSize: 100}).(*service)
+			entries, err := s.fetchUnreadEntries(1, tt.after, newEntryBudget(tt.limit))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != tt.wantEntries || requests != tt.wantRequests {
+				t.Errorf("fetchUnreadEntries() = %d entries in %d requests, want %d in %d", len(entries), requests, tt.wantEntries, tt.wantRequests)
+			}
+			for i, entry := range entries {
+				if want := tt.after + int64(i+1); entry.ID != want {
+					t.Fatalf("fetchUnreadEntries() entry %d has ID %d, want %d", i, entry.ID, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRunFilterJobIncremental(t *testing.T) {
+	var (
+		lastEntryID int64 = 3
+		afterIDs    []int64
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v1/feeds":
+			json.NewEncoder(w).Encode(miniflux.Feeds{{ID: 1, FeedURL: "https://example.com/feed.xml"}})
+		case r.Method == http.MethodGet && r.URL.Path == "/v1/feeds/1/entries":
+			after, _ := strconv.ParseInt(r.URL.Query().Get("after_entry_id"), 10, 64)
+			afterIDs = append(afterIDs, after)
+			var result miniflux.EntryResultSet
+			for id := after + 1; id <= lastEntryID; id++ {
+				result.Entries = append(result.Entries, &miniflux.Entry{ID: id, Title: fmt.Sprintf("Moon %d", id)})
+			}
+			result.Total = len(result.Entries)
+			json.NewEncoder(w).Encode(result)
+		case r.Method == http.MethodPut && r.URL.Path == "/v1/entries":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+		}
+	}))
+	defer srv.Close()
+
+	var (
+		moon = []rules.Rule{{Command: "ignore-article", URL: "*", FilterExpression: "title # Moon"}}
+		sun  = []rules.Rule{{Command: "ignore-article", URL: "*", FilterExpression: "title # Sun"}}
+		age  = []rules.Rule{{Command: "ignore-article", URL: "*", FilterExpression: "age > 7"}}
+	)
+	steps := []struct {
+		name       string
+		rules      []rules.Rule
+		newEntries int64
+		simulation bool
+		wantAfter  int64
+	}{
+		{name: "First run evaluates all entries", rules: moon, wantAfter: 0},
+		{name: "Next run only fetches new entries", rules: moon, newEntries: 2, wantAfter: 3},
+		{name: "Simulation", rules: moon, newEntries: 1, simulation: true, wantAfter: 5},
+		{name: "Simulation doesn't save the state", rules: moon, wantAfter: 5},
+		{name: "Changed rules evaluate all entries again", rules: sun, wantAfter: 0},
+		{name: "Unchanged rules", rules: sun, wantAfter: 6},
+		{name: "Volatile rules evaluate all entries", rules: age, wantAfter: 0},
+		{name: "Volatile rules always evaluate all entries", rules: age, wantAfter: 0},
+	}
+
+	rr, err := rules.NewRepository(nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewService(log.NewNopLogger(), miniflux.New(srv.URL, "api-key"), rr, Config{Strategy: StrategyFeed})
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			afterIDs = nil
+			lastEntryID += step.newEntries
+			rr.SetCachedRules(step.rules)
+			s.RunFilterJob(step.simulation)
+			if want := []int64{step.wantAfter}; !reflect.DeepEqual(afterIDs, want) {
+				t.Errorf("RunFilterJob() fetched entries after %v, want %v", afterIDs, want)
+			}
+		})
+	}
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name     string
+		entries  int64
+		failures map[int64]int
+		// wantFailed is the number of entries the action couldn't be applied to
+		wantFailed int
+		// wantBatches contains the first entry ID of every request
+		wantBatches []int64
+		// wantDelays is the number of times apply waited before sending a failed batch again
+		wantDelays int
+	}{
+		{name: "Batches", entries: 250, wantBatches: []int64{1, 101, 201}},
+		{name: "Single batch", entries: 30, wantBatches: []int64{1}},
+		{name: "Failed batch is retried", entries: 250, failures: map[int64]int{101: 2}, wantBatches: []int64{1, 101, 101, 101, 201}, wantDelays: 2},
+		{name: "Remaining batches are sent after a batch failed", entries: 250, failures: map[int64]int{1: 3}, wantFailed: 100, wantBatches: []int64{1, 1, 1, 101, 201}, wantDelays: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var batches []int64
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var payload struct {
+					EntryIDs []int64 `json:"entry_ids"`
+					Status   string  `json:"status"`
+				}
+				if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || payload.Status != miniflux.EntryStatusRead {
+					t.Errorf("unexpected request %s: %v %+v", r.URL, err, payload)
+				}
+				first := payload.EntryIDs[0]
+				batches = append(batches, first)
+				if tt.failures[first] > 0 {
+					tt.failures[first]--
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+				w.WriteHeader(http.StatusNoContent)
+			}))
+			defer srv.Close()
+
+			var matched []matchedEntry
+			for id := int64(1); id <= tt.entries; id++ {
+				matched = append(matched, matchedEntry{entry: &miniflux.Entry{ID: id}})
+			}
+			now := time.Now()
+			c := newTestResilientClient(miniflux.New(srv.URL, "api-key"), ResilienceConfig{Attempts: 3, FailureThreshold: 10}, &now)
+			var delays int
+			c.sleep = func(d time.Duration) {
+				if d <= 0 {
+					t.Errorf("apply() retried a batch after a delay of %v, want a positive delay", d)
+				}
+				delays++
+			}
+			s := NewService(log.NewNopLogger(), c, nil, Config{BatchSize: 100}).(*service)
+			failed := s.apply(rules.ActionRead, matched)
+			if len(failed) != tt.wantFailed {
+				t.Errorf("apply() failed for %d entries, want %d", len(failed), tt.wantFailed)
+			}
+			for id := int64(1); id <= int64(tt.wantFailed); id++ {
+				if !failed[id] {
+					t.Errorf("apply() didn't fail for entry %d of the failed batch", id)
+				}
+			}
+			if !reflect.DeepEqual(batches, tt.wantBatches) {
+				t.Errorf("apply() sent batches %v, want %v", batches, tt.wantBatches)
+			}
+			if delays != tt.wantDelays {
+				t.Errorf("apply() waited %d times before retrying a batch, want %d", delays, tt.wantDelays)
+			}
+		})
+	}
+}
+
+func TestRunFilterJobConcurrent(t *testing.T) {
+	const (
+		feeds          = 20
+		entriesPerFeed = 30
+	)
+	var (
+		mutex   sync.Mutex
+		read    = make(map[int64]bool)
+		fetched int
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v1/feeds":
+			var result miniflux.Feeds
+			for id := int64(1); id <= feeds; id++ {
+				result = append(result, &miniflux.Feed{ID: id, FeedURL: fmt.Sprintf("https://example.com/%d.xml", id)})
+			}
+			json.NewEncoder(w).Encode(result)
+		case r.Method == http.MethodGet && (r.URL.Path == "/v1/entries" || strings.HasPrefix(r.URL.Path, "/v1/feeds/")):
+			// Entry n of feed f has the ID f*1000+n, every third entry is about the moon
+			firstFeed, lastFeed := int64(1), int64(feeds)
+			if r.URL.Path != "/v1/entries" {
+				firstFeed, _ = strconv.ParseInt(strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/v1/feeds/"), "/entries"), 10, 64)
+				lastFeed = firstFeed
+			}
+			after, _ := strconv.ParseInt(r.URL.Query().Get("after_entry_id"), 10, 64)
+			limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+			var result miniflux.EntryResultSet
+			for feedID := firstFeed; feedID <= lastFeed; feedID++ {
+				feed := &miniflux.Feed{ID: feedID, FeedURL: fmt.Sprintf("https://example.com/%d.xml", feedID)}
+				for n := int64(1); n <= entriesPerFeed; n++ {
+					id := feedID*1000 + n
+					if id <= after {
+						continue
+					}
+					result.Total++
+					if len(result.Entries) == limit {
+						continue
+					}
+					title := "Sun"
+					if n%3 == 0 {
+						title = "Moon"
+					}
+					result.Entries = append(result.Entries, &miniflux.Entry{ID: id, FeedID: feedID, Title: title, Feed: feed})
+				}
+			}
+			mutex.Lock()
+			fetched += len(result.Entries)
+			mutex.Unlock()
+			json.NewEncoder(w).Encode(result)
+		case r.Method == http.MethodPut && r.URL.Path == "/v1/entries":
+			var payload struct {
+				EntryIDs []int64 `json:"entry_ids"`
+			}
+			json.NewDecoder(r.Body).Decode(&payload)
+			mutex.Lock()
+			for _, id := range payload.EntryIDs {
+				read[id] = true
+			}
+			mutex.Unlock()
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+		}
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name             string
+		strategy         Strategy
+		maxEntriesPerRun int
+		wantFetched      int
+	}{
+		{name: "Feed", strategy: StrategyFeed, wantFetched: feeds * entriesPerFeed},
+		{name: "Feed limited", strategy: StrategyFeed, maxEntriesPerRun: 100, wantFetched: 100},
+		{name: "Global", strategy: StrategyGlobal, wantFetched: feeds * entriesPerFeed},
+		{name: "Global limited", strategy: StrategyGlobal, maxEntriesPerRun: 100, wantFetched: 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			read = make(map[int64]bool)
+			fetched = 0
+			rr, err := rules.NewRepository(nil, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rr.SetCachedRules([]rules.Rule{{Command: "ignore-article", URL: "*", FilterExpression: "title = Moon"}})
+			s := NewService(log.NewNopLogger(), miniflux.New(srv.URL, "api-key"), rr, Config{
+				PageSize:         7,
+				Concurrency:      8,
+				MaxEntriesPerRun: tt.maxEntriesPerRun,
+				Strategy:         tt.strategy,
+			})
+			s.RunFilterJob(false)
+
+			if fetched != tt.wantFetched {
+				t.Errorf("RunFilterJob() fetched %d entries, want %d", fetched, tt.wantFetched)
+			}
+			// With a limit it depends on the order of the workers how many entries of a feed are fetched, every feed can
+			// end with up to two fetched entries that aren't about the moon
+			want := tt.wantFetched / 3
+			if len(read) != want && (tt.maxEntriesPerRun == 0 || len(read) < want-feeds || len(read) > want+feeds) {
+				t.Errorf("RunFilterJob() marked %d entries as read, want %d", len(read), want)
+			}
+			for id := range read {
+				if id%1000%3 != 0 {
+					t.Errorf("RunFilterJob() marked entry %d as read", id)
+				}
+			}
+		})
+	}
+}
+
+// The in-memory client has to implement the interface of the service
+var _ Client = (*minifluxtest.Client)(nil)
+
+func TestRunFilterJob(t *testing.T) {
+	moonEntries := func(n int) []*miniflux.Entry {
+		var entries []*miniflux.Entry
+		for id := int64(1); id <= int64(n); id++ {
+			entries = append(entries, &miniflux.Entry{ID: id, FeedID: 1, Title: "Moon"})
+		}
+		return entries
+	}
+	moonRule := []rules.Rule{{Command: "ignore-article", URL: "host:example.com", FilterExpression: "title = Moon"}}
+	errServer := errors.New("server error")
+
+	tests := []struct {
+		name       string
+		rules      []rules.Rule
+		entries    []*miniflux.Entry
+		cfg        Config
+		simulation bool
+		errs       map[string][]error
+		// between is called between two runs if it's set, the expectations are checked after the second run
+		between    func(c *minifluxtest.Client)
+		wantStatus map[int64]string
+		wantStar   []int64
+		wantCalls  map[string]int
+	}{
+		{
+			name: "Actions are applied",
+			rules: []rules.Rule{
+				{Command: "ignore-article", URL: "*", FilterExpression: "title = Moon"},
+				{Command: "remove-article", URL: "*", FilterExpression: "title = Sun"},
+				{Command: "star-article", URL: "*", FilterExpression: "author = Bob"},
+			},
+			entries: []*miniflux.Entry{
+				{ID: 1, FeedID: 1, Title: "Moon"},
+				{ID: 2, FeedID: 1, Title: "Sun"},
+				{ID: 3, FeedID: 2, Title: "Stars", Author: "Bob"},
+				{ID: 4, FeedID: 2, Title: "Comet"},
+			},
+			wantStatus: map[int64]string{1: miniflux.EntryStatusRead, 2: miniflux.EntryStatusRemoved, 3: miniflux.EntryStatusUnread, 4: miniflux.EntryStatusUnread},
+			wantStar:   []int64{3},
+		},
+		{
+			name: "Simulation doesn't change entries",
+			rules: []rules.Rule{
+				{Command: "ignore-article", URL: "*", FilterExpression: "title = Moon"},
+				{Command: "star-article", URL: "*", FilterExpression: "author = Bob"},
+			},
+			entries: []*miniflux.Entry{
+				{ID: 1, FeedID: 1, Title: "Moon", Author: "Bob"},
+			},
+			simulation: true,
+			wantStatus: map[int64]string{1: miniflux.EntryStatusUnread},
+			wantCalls:  map[string]int{"UpdateEntries": 0, "ToggleBookmark": 0},
+		},
+		{
+			name: "Only feeds with rules are fetched",
+			rules: []rules.Rule{
+				{Command: "ignore-article", URL: "host:other.example.org", FilterExpression: "title = Moon"},
+				{Command: "keep-article", URL: "host:example.com", FilterExpression: "title = Moon"},
+			},
+			entries: []*miniflux.Entry{
+				{ID: 1, FeedID: 1, Title: "Moon"},
+				{ID: 2, FeedID: 2, Title: "Moon"},
+			},
+			wantStatus: map[int64]string{1: miniflux.EntryStatusUnread, 2: miniflux.EntryStatusRead},
+			wantCalls:  map[string]int{"FeedEntries": 1},
+		},
+		{
+			name:       "Pages",
+			rules:      moonRule,
+			entries:    moonEntries(25),
+			cfg:        Config{PageSize: 10},
+			wantStatus: map[int64]string{1: miniflux.EntryStatusRead, 25: miniflux.EntryStatusRead},
+			wantCalls:  map[string]int{"FeedEntries": 3, "UpdateEntries": 1},
+		},
+		{
+			name:       "Maximum entries per run",
+			rules:      moonRule,
+			entries:    moonEntries(25),
+			cfg:        Config{PageSize: 10, MaxEntriesPerRun: 15},
+			wantStatus: map[int64]string{15: miniflux.EntryStatusRead, 16: miniflux.EntryStatusUnread},
+			wantCalls:  map[string]int{"FeedEntries": 2},
+		},
+		{
+			name:       "Batches",
+			rules:      moonRule,
+			entries:    moonEntries(25),
+			cfg:        Config{BatchSize: 10},
+			wantStatus: map[int64]string{1: miniflux.EntryStatusRead, 25: miniflux.EntryStatusRead},
+			wantCalls:  map[string]int{"UpdateEntries": 3},
+		},
+		{
+			name:       "Remaining batches are sent after a batch failed",
+			rules:      moonRule,
+			entries:    moonEntries(25),
+			cfg:        Config{BatchSize: 10},
+			errs:       map[string][]error{"UpdateEntries": {errServer}},
+			wantStatus: map[int64]string{1: miniflux.EntryStatusUnread, 11: miniflux.EntryStatusRead, 25: miniflux.EntryStatusRead},
+			wantCalls:  map[string]int{"UpdateEntries": 3},
+		},
+		{
+			name:  "Failed feed doesn't stop the run",
+			rules: []rules.Rule{{Command: "ignore-article", URL: "contains:example", FilterExpression: "title = Moon"}},
+			entries: []*miniflux.Entry{
+				{ID: 1, FeedID: 1, Title: "Moon"},
+				{ID: 2, FeedID: 2, Title: "Moon"},
+			},
+			cfg:        Config{Concurrency: 1, Strategy: StrategyFeed},
+			errs:       map[string][]error{"FeedEntries": {errServer}},
+			wantStatus: map[int64]string{1: miniflux.EntryStatusUnread, 2: miniflux.EntryStatusRead},
+		},
+		{
+			name: "Rules only apply to their own feed with the feed strategy",
+			rules: []rules.Rule{
+				{Command: "ignore-article", URL: "host:other.example.org", FilterExpression: "title = Moon"},
+				{Command: "ignore-article", URL: "host:example.com", FilterExpression: "title = Sun"},
+			},
+			entries: []*miniflux.Entry{
+				{ID: 1, FeedID: 1, Title: "Moon"},
+				{ID: 2, FeedID: 1, Title: "Sun"},
+				{ID: 3, FeedID: 2, Title: "Moon"},
+				{ID: 4, FeedID: 2, Title: "Sun"},
+			},
+			cfg:        Config{Strategy: StrategyFeed},
+			wantStatus: map[int64]string{1: miniflux.EntryStatusUnread, 2: miniflux.EntryStatusRead, 3: miniflux.EntryStatusRead, 4: miniflux.EntryStatusUnread},
+		},
+		{
+			name: "Rules only apply to their own feed with the global strategy",
+			rules: []rules.Rule{
+				{Command: "ignore-article", URL: "host:other.example.org", FilterExpression: "title = Moon"},
+				{Command: "ignore-article", URL: "host:example.com", FilterExpression: "title = Sun"},
+			},
+			entries: []*miniflux.Entry{
+				{ID: 1, FeedID: 1, Title: "Moon"},
+				{ID: 2, FeedID: 1, Title: "Sun"},
+				{ID: 3, FeedID: 2, Title: "Moon"},
+				{ID: 4, FeedID: 2, Title: "Sun"},
+			},
+			cfg:        Config{Strategy: StrategyGlobal},
+			wantStatus: map[int64]string{1: miniflux.EntryStatusUnread, 2: miniflux.EntryStatusRead, 3: miniflux.EntryStatusRead, 4: miniflux.EntryStatusUnread},
+		},
+		{
+			name:  "Global strategy",
+			rules: []rules.Rule{{Command: "ignore-article", URL: "*", FilterExpression: "title = Moon"}},
+			entries: []*miniflux.Entry{
+				{ID: 1, FeedID: 1, Title: "Moon"},
+				{ID: 2, FeedID: 2, Title: "Moon"},
+			},
+			wantStatus: map[int64]string{1: miniflux.EntryStatusRead, 2: miniflux.EntryStatusRead},
+			wantCalls:  map[string]int{"Entries": 1, "FeedEntries": 0},
+		},
+		{
+			name: "Category blocks only apply to the feeds of their category",
+			rules: []rules.Rule{
+				{Command: "ignore-article", URL: "*", FilterExpression: "title = Moon", Category: "tech news"},
+				{Command: "ignore-article", URL: "*", FilterExpression: "title = Sun", CategoryID: 2},
+			},
+			entries: []*miniflux.Entry{
+				{ID: 1, FeedID: 1, Title: "Moon"},
+				{ID: 2, FeedID: 1, Title: "Sun"},
+				{ID: 3, FeedID: 2, Title: "Moon"},
+				{ID: 4, FeedID: 2, Title: "Sun"},
+			},
+			wantStatus: map[int64]string{1: miniflux.EntryStatusRead, 2: miniflux.EntryStatusUnread, 3: miniflux.EntryStatusUnread, 4: miniflux.EntryStatusRead},
+			wantCalls:  map[string]int{"Categories": 1, "Entries": 0, "FeedEntries": 2},
+		},
+		{
+			name:       "Category blocks of unknown categories don't match any feed",
+			rules:      []rules.Rule{{Command: "ignore-article", URL: "*", FilterExpression: "title = Moon", Category: "Science"}},
+			entries:    moonEntries(1),
+			wantStatus: map[int64]string{1: miniflux.EntryStatusUnread},
+			wantCalls:  map[string]int{"FeedEntries": 0},
+		},
+		{
+			name:       "Run is skipped if the categories can't be fetched",
+			rules:      []rules.Rule{{Command: "ignore-article", URL: "*", FilterExpression: "title = Moon", Category: "Tech News"}},
+			entries:    moonEntries(1),
+			errs:       map[string][]error{"Categories": {errServer}},
+			wantStatus: map[int64]string{1: miniflux.EntryStatusUnread},
+			wantCalls:  map[string]int{"Feeds": 0},
+		},
+		{
+			name: "Entries are evaluated again after a feed moved to another category with the feed strategy",
+			rules: []rules.Rule{
+				{Command: "ignore-article", URL: "host:example.com", FilterExpression: "title = Sun"},
+				{Command: "ignore-article", URL: "*", FilterExpression: "title = Moon", Category: "Sports"},
+			},
+			entries: []*miniflux.Entry{
+				{ID: 1, FeedID: 1, Title: "Moon"},
+				{ID: 2, FeedID: 1, Title: "Sun"},
+			},
+			cfg: Config{Strategy: StrategyFeed},
+			between: func(c *minifluxtest.Client) {
+				c.UpdateFeed(&miniflux.Feed{ID: 1, FeedURL: "https://example.com/feed.xml", Category: &miniflux.Category{ID: 2, Title: "Sports"}})
+			},
+			wantStatus: map[int64]string{1: miniflux.EntryStatusRead, 2: miniflux.EntryStatusRead},
+		},
+		{
+			name: "Entries are evaluated again after a feed moved to another category with the global strategy",
+			rules: []rules.Rule{
+				{Command: "ignore-article", URL: "host:example.com", FilterExpression: "title = Sun"},
+				{Command: "ignore-article", URL: "*", FilterExpression: "title = Moon", Category: "Sports"},
+			},
+			entries: []*miniflux.Entry{
+				{ID: 1, FeedID: 1, Title: "Moon"},
+				{ID: 2, FeedID: 1, Title: "Sun"},
+			},
+			cfg: Config{Strategy: StrategyGlobal},
+			between: func(c *minifluxtest.Client) {
+				c.UpdateFeed(&miniflux.Feed{ID: 1, FeedURL: "https://example.com/feed.xml", Category: &miniflux.Category{ID: 2, Title: "Sports"}})
+			},
+			wantStatus: map[int64]string{1: miniflux.EntryStatusRead, 2: miniflux.EntryStatusRead},
+		},
+		{
+			name:       "Categories are only fetched for category blocks",
+			rules:      moonRule,
+			entries:    moonEntries(1),
+			wantStatus: map[int64]string{1: miniflux.EntryStatusRead},
+			wantCalls:  map[string]int{"Categories": 0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := minifluxtest.NewClient()
+			client.AddFeeds(
+				&miniflux.Feed{ID: 1, FeedURL: "https://example.com/feed.xml", Category: &miniflux.Category{ID: 1, Title: "Tech News"}},
+				&miniflux.Feed{ID: 2, FeedURL: "https://other.example.org/feed.xml", Category: &miniflux.Category{ID: 2, Title: "Sports"}},
+			)
+			client.AddEntries(tt.entries...)
+			for method, errs := range tt.errs {
+				client.FailNext(method, errs...)
+			}
+			rr, err := rules.NewRepository(nil, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rr.SetCachedRules(tt.rules)
+
+			s := NewService(log.NewNopLogger(), client, rr, tt.cfg)
+			s.RunFilterJob(tt.simulation)
+			if tt.between != nil {
+				if got := client.Status(1); got != miniflux.EntryStatusUnread {
+					t.Fatalf("RunFilterJob() entry 1 has status %q before the second run, want %q", got, miniflux.EntryStatusUnread)
+				}
+				tt.between(client)
+				s.RunFilterJob(tt.simulation)
+			}
+
+			for id, want := range tt.wantStatus {
+				if got := client.Status(id); got != want {
+					t.Errorf("RunFilterJob() entry %d has status %q, want %q", id, got, want)
+				}
+			}
+			for _, entry := range tt.entries {
+				want := false
+				for _, id := range tt.wantStar {
+					want = want || id == entry.ID
+				}
+				if got := client.Starred(entry.ID); got != want {
+					t.Errorf("RunFilterJob() entry %d starred = %v, want %v", entry.ID, got, want)
+				}
+			}
+			for method, want := range tt.wantCalls {
+				if got := client.Calls(method); got != want {
+					t.Errorf("RunFilterJob() called %s %d times, want %d", method, got, want)
+				}
+			}
+		})
+	}
+}
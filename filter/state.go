@@ -0,0 +1,123 @@
+package filter
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// State is the progress of the filter job that's kept between runs
+type State struct {
+	// RulesChecksum identifies the rule set the entries were evaluated with
+	RulesChecksum string `json:"rules_checksum"`
+
+	// LastEntryIDs contains the ID of the last evaluated entry per feed ID
+	LastEntryIDs map[int64]int64 `json:"last_entry_ids"`
+
+	// LastEntryID is the ID of the last evaluated entry if the entries of all feeds are fetched at once
+	LastEntryID int64 `json:"last_entry_id,omitempty"`
+
+	// FeedRules contains the fingerprint of the rules that applied to a feed when its entries were evaluated, per
+	// feed ID
+	FeedRules map[int64]string `json:"feed_rules,omitempty"`
+}
+
+// StateStore persists the state of the filter job
+type StateStore interface {
+	// Load returns the last saved state, or an empty state if there is none
+	Load() (State, error)
+
+	// Save replaces the saved state
+	Save(state State) error
+}
+
+type memoryStateStore struct {
+	mutex sync.Mutex
+	state State
+}
+
+// NewMemoryStateStore returns a state store that keeps the state in memory, it's lost on restart
+func NewMemoryStateStore() StateStore {
+	return &memoryStateStore{}
+}
+
+func (s *memoryStateStore) Load() (State, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.state.copy(), nil
+}
+
+func (s *memoryStateStore) Save(state State) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.state = state.copy()
+	return nil
+}
+
+type fileStateStore struct {
+	path string
+}
+
+// NewFileStateStore returns a state store that keeps the state in a JSON file
+func NewFileStateStore(path string) StateStore {
+	return &fileStateStore{
+		path: path,
+	}
+}
+
+func (s *fileStateStore) Load() (State, error) {
+	b, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return State{}, nil
+	}
+	if err != nil {
+		return State{}, err
+	}
+	var state State
+	if err := json.Unmarshal(b, &state); err != nil {
+		return State{}, err
+	}
+	return state, nil
+}
+
+// Save writes the state to a temporary file first, so a crash never leaves a partially written state behind
+func (s *fileStateStore) Save(state State) error {
+	b, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), s.path)
+}
+
+func (s State) copy() State {
+	c := State{
+		RulesChecksum: s.RulesChecksum,
+		LastEntryID:   s.LastEntryID,
+		LastEntryIDs:  make(map[int64]int64, len(s.LastEntryIDs)),
+	}
+	for feedID, entryID := range s.LastEntryIDs {
+		c.LastEntryIDs[feedID] = entryID
+	}
+	if s.FeedRules != nil {
+		c.FeedRules = make(map[int64]string, len(s.FeedRules))
+		for feedID, fp := range s.FeedRules {
+			c.FeedRules[feedID] = fp
+		}
+	}
+	return c
+}
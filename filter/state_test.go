@@ -0,0 +1,52 @@
+package filter
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestStateStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name  string
+		store StateStore
+	}{
+		{name: "Memory", store: NewMemoryStateStore()},
+		{name: "File", store: NewFileStateStore(filepath.Join(dir, "state.json"))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state, err := tt.store.Load()
+			if err != nil {
+				t.Fatalf("Load() of an empty store returned error: %v", err)
+			}
+			if state.RulesChecksum != "" || len(state.LastEntryIDs) != 0 {
+				t.Errorf("Load() of an empty store = %+v, want empty state", state)
+			}
+
+			saved := State{RulesChecksum: "abc", LastEntryIDs: map[int64]int64{1: 42, 7: 1000}}
+			if err := tt.store.Save(saved); err != nil {
+				t.Fatal(err)
+			}
+			// Changing the state after saving it must not change the store
+			saved.LastEntryIDs[1] = 43
+
+			want := State{RulesChecksum: "abc", LastEntryIDs: map[int64]int64{1: 42, 7: 1000}}
+			got, err := tt.store.Load()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Load() = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
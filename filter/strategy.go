@@ -0,0 +1,42 @@
+package filter
+
+import (
+	"fmt"
+
+	"github.com/dewey/miniflux-sidekick/rules"
+)
+
+// Strategy decides how the unread entries are fetched from Miniflux
+type Strategy string
+
+const (
+	// StrategyAuto uses the global strategy if a rule applies to all feeds and the feed strategy otherwise
+	StrategyAuto Strategy = "auto"
+	// StrategyFeed fetches the unread entries of every feed that matches a rule separately
+	StrategyFeed Strategy = "feed"
+	// StrategyGlobal fetches the unread entries of all feeds at once and routes them to the rules of their feed
+	StrategyGlobal Strategy = "global"
+)
+
+// ParseStrategy returns the strategy with the given name
+func ParseStrategy(name string) (Strategy, error) {
+	switch st := Strategy(name); st {
+	case StrategyAuto, StrategyFeed, StrategyGlobal:
+		return st, nil
+	}
+	return "", fmt.Errorf("unknown strategy %q, has to be %q, %q or %q", name, StrategyAuto, StrategyFeed, StrategyGlobal)
+}
+
+// strategy returns the strategy used for the rule set. With a rule for all feeds the unread entries of every feed
+// have to be fetched, so it's cheaper to fetch them all at once than to send a request per feed.
+func (s *service) strategy(rs *rules.RuleSet) Strategy {
+	if s.cfg.Strategy != StrategyAuto {
+		return s.cfg.Strategy
+	}
+	for _, rule := range rs.Compiled() {
+		if rule.Command != rules.CommandKeepArticle && rule.Selector.All() && !rule.Scoped() {
+			return StrategyGlobal
+		}
+	}
+	return StrategyFeed
+}
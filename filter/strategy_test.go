@@ -0,0 +1,128 @@
+package filter
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/dewey/miniflux-sidekick/rules"
+	"github.com/go-kit/kit/log"
+	miniflux "miniflux.app/client"
+)
+
+func TestStrategy(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy Strategy
+		rules    []rules.Rule
+		want     Strategy
+	}{
+		{
+			name:     "Wildcard rule",
+			strategy: StrategyAuto,
+			rules: []rules.Rule{
+				{Command: "ignore-article", URL: "https://example.com", FilterExpression: "title = Moon"},
+				{Command: "star-article", URL: "*", FilterExpression: "author = Bob"},
+			},
+			want: StrategyGlobal,
+		},
+		{
+			name:     "Feed rules",
+			strategy: StrategyAuto,
+			rules: []rules.Rule{
+				{Command: "ignore-article", URL: "https://example.com", FilterExpression: "title = Moon"},
+			},
+			want: StrategyFeed,
+		},
+		{
+			name:     "Wildcard keep rule",
+			strategy: StrategyAuto,
+			rules: []rules.Rule{
+				{Command: "ignore-article", URL: "https://example.com", FilterExpression: "title = Moon"},
+				{Command: "keep-article", URL: "*", FilterExpression: "author = Bob"},
+			},
+			want: StrategyFeed,
+		},
+		{
+			name:     "Configured",
+			strategy: StrategyFeed,
+			rules: []rules.Rule{
+				{Command: "ignore-article", URL: "*", FilterExpression: "title = Moon"},
+			},
+			want: StrategyFeed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewService(log.NewNopLogger(), nil, nil, Config{Strategy: tt.strategy}).(*service)
+			if got := s.strategy(rules.NewRuleSet(tt.rules)); got != tt.want {
+				t.Errorf("strategy() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunFilterJobGlobal(t *testing.T) {
+	var (
+		feeds = []*miniflux.Feed{
+			{ID: 1, FeedURL: "https://example.com/feed.xml"},
+			{ID: 2, FeedURL: "https://other.example.org/feed.xml"},
+		}
+		// The entries alternate between the feeds, all of them are about the moon
+		lastEntryID int64 = 6
+		afterIDs    []int64
+		read        []int64
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v1/feeds":
+			json.NewEncoder(w).Encode(feeds)
+		case r.Method == http.MethodGet && r.URL.Path == "/v1/entries":
+			after, _ := strconv.ParseInt(r.URL.Query().Get("after_entry_id"), 10, 64)
+			afterIDs = append(afterIDs, after)
+			var result miniflux.EntryResultSet
+			for id := after + 1; id <= lastEntryID; id++ {
+				feed := feeds[id%2]
+				result.Entries = append(result.Entries, &miniflux.Entry{ID: id, FeedID: feed.ID, Feed: feed, Title: "Moon"})
+			}
+			result.Total = len(result.Entries)
+			json.NewEncoder(w).Encode(result)
+		case r.Method == http.MethodPut && r.URL.Path == "/v1/entries":
+			var payload struct {
+				EntryIDs []int64 `json:"entry_ids"`
+			}
+			json.NewDecoder(r.Body).Decode(&payload)
+			read = append(read, payload.EntryIDs...)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+		}
+	}))
+	defer srv.Close()
+
+	rr, err := rules.NewRepository(nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Only the entries of the second feed are routed to the rule
+	rr.SetCachedRules([]rules.Rule{{Command: "ignore-article", URL: "host:other.example.org", FilterExpression: "title = Moon"}})
+	s := NewService(log.NewNopLogger(), miniflux.New(srv.URL, "api-key"), rr, Config{Strategy: StrategyGlobal})
+
+	s.RunFilterJob(false)
+	if want := []int64{1, 3, 5}; !reflect.DeepEqual(read, want) {
+		t.Errorf("RunFilterJob() marked %v as read, want %v", read, want)
+	}
+
+	afterIDs, read = nil, nil
+	lastEntryID = 8
+	s.RunFilterJob(false)
+	if want := []int64{6}; !reflect.DeepEqual(afterIDs, want) {
+		t.Errorf("RunFilterJob() fetched entries after %v, want %v", afterIDs, want)
+	}
+	if want := []int64{7}; !reflect.DeepEqual(read, want) {
+		t.Errorf("RunFilterJob() marked %v as read, want %v", read, want)
+	}
+}
@@ -0,0 +1,296 @@
+// Package minifluxtest provides an in-memory Miniflux client for tests
+package minifluxtest
+
+import (
+	"sort"
+	"sync"
+
+	miniflux "miniflux.app/client"
+)
+
+// Client is an in-memory implementation of the Miniflux API calls used by the sidekick. It keeps feeds and entries,
+// applies status updates and bookmarks to them and returns injected errors. It's safe for concurrent use.
+type Client struct {
+	mutex      sync.Mutex
+	categories []*miniflux.Category
+	feeds      []*miniflux.Feed
+	entries    []*miniflux.Entry
+	errs       map[string][]error
+	calls      map[string]int
+}
+
+// NewClient returns an empty client
+func NewClient() *Client {
+	return &Client{
+		errs:  make(map[string][]error),
+		calls: make(map[string]int),
+	}
+}
+
+// AddCategories adds categories to the client. The categories of the added feeds are added as well, this is only
+// needed for categories without feeds.
+func (c *Client) AddCategories(categories ...*miniflux.Category) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for _, category := range categories {
+		c.addCategory(category)
+	}
+}
+
+// AddFeeds adds feeds to the client
+func (c *Client) AddFeeds(feeds ...*miniflux.Feed) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.feeds = append(c.feeds, feeds...)
+	for _, feed := range feeds {
+		if feed.Category != nil {
+			c.addCategory(feed.Category)
+		}
+	}
+}
+
+// UpdateFeed replaces the feed with the same ID, like after the feed was moved to another category
+func (c *Client) UpdateFeed(feed *miniflux.Feed) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for i, f := range c.feeds {
+		if f.ID == feed.ID {
+			c.feeds[i] = feed
+		}
+	}
+	if feed.Category != nil {
+		c.addCategory(feed.Category)
+	}
+}
+
+// AddEntries adds entries to the client, entries without a status are unread. The feed of an entry is looked up by
+// its feed ID when the entry is returned, the feed of the given entry is only used for its ID.
+func (c *Client) AddEntries(entries ...*miniflux.Entry) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for _, entry := range entries {
+		e := *entry
+		if e.Status == "" {
+			e.Status = miniflux.EntryStatusUnread
+		}
+		if e.FeedID == 0 && e.Feed != nil {
+			e.FeedID = e.Feed.ID
+		}
+		e.Feed = nil
+		c.entries = append(c.entries, &e)
+	}
+	sort.Slice(c.entries, func(i, j int) bool { return c.entries[i].ID < c.entries[j].ID })
+}
+
+// FailNext makes the next calls of the method with the given name return the errors, one error per call
+func (c *Client) FailNext(method string, errs ...error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.errs[method] = append(c.errs[method], errs...)
+}
+
+// Calls returns how often the method with the given name was called
+func (c *Client) Calls(method string) int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.calls[method]
+}
+
+// Status returns the status of an entry, it's empty if there's no entry with the ID
+func (c *Client) Status(entryID int64) string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if e := c.entry(entryID); e != nil {
+		return e.Status
+	}
+	return ""
+}
+
+// Starred reports whether an entry is starred
+func (c *Client) Starred(entryID int64) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if e := c.entry(entryID); e != nil {
+		return e.Starred
+	}
+	return false
+}
+
+// Categories returns all categories
+func (c *Client) Categories() (miniflux.Categories, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if err := c.call("Categories"); err != nil {
+		return nil, err
+	}
+	categories := make(miniflux.Categories, 0, len(c.categories))
+	for _, category := range c.categories {
+		cat := *category
+		categories = append(categories, &cat)
+	}
+	return categories, nil
+}
+
+// Feeds returns all feeds
+func (c *Client) Feeds() (miniflux.Feeds, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if err := c.call("Feeds"); err != nil {
+		return nil, err
+	}
+	feeds := make(miniflux.Feeds, 0, len(c.feeds))
+	for _, feed := range c.feeds {
+		f := *feed
+		feeds = append(feeds, &f)
+	}
+	return feeds, nil
+}
+
+// Entry returns a single entry
+func (c *Client) Entry(entryID int64) (*miniflux.Entry, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if err := c.call("Entry"); err != nil {
+		return nil, err
+	}
+	e := c.entry(entryID)
+	if e == nil {
+		return nil, miniflux.ErrNotFound
+	}
+	return c.copyEntry(e), nil
+}
+
+// Entries returns the entries of all feeds that match the filter
+func (c *Client) Entries(filter *miniflux.Filter) (*miniflux.EntryResultSet, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if err := c.call("Entries"); err != nil {
+		return nil, err
+	}
+	return c.find(0, filter), nil
+}
+
+// FeedEntries returns the entries of a feed that match the filter
+func (c *Client) FeedEntries(feedID int64, filter *miniflux.Filter) (*miniflux.EntryResultSet, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if err := c.call("FeedEntries"); err != nil {
+		return nil, err
+	}
+	return c.find(feedID, filter), nil
+}
+
+// UpdateEntries changes the status of entries, unknown entries are ignored like Miniflux does
+func (c *Client) UpdateEntries(entryIDs []int64, status string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if err := c.call("UpdateEntries"); err != nil {
+		return err
+	}
+	for _, id := range entryIDs {
+		if e := c.entry(id); e != nil {
+			e.Status = status
+		}
+	}
+	return nil
+}
+
+// ToggleBookmark stars or unstars an entry
+func (c *Client) ToggleBookmark(entryID int64) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if err := c.call("ToggleBookmark"); err != nil {
+		return err
+	}
+	e := c.entry(entryID)
+	if e == nil {
+		return miniflux.ErrNotFound
+	}
+	e.Starred = !e.Starred
+	return nil
+}
+
+// call counts the call of a method and returns the next injected error for it
+func (c *Client) call(method string) error {
+	c.calls[method]++
+	if len(c.errs[method]) == 0 {
+		return nil
+	}
+	err := c.errs[method][0]
+	c.errs[method] = c.errs[method][1:]
+	return err
+}
+
+// addCategory adds a copy of the category unless there's one with the same ID already
+func (c *Client) addCategory(category *miniflux.Category) {
+	for _, existing := range c.categories {
+		if existing.ID == category.ID {
+			return
+		}
+	}
+	cat := *category
+	c.categories = append(c.categories, &cat)
+}
+
+func (c *Client) entry(entryID int64) *miniflux.Entry {
+	for _, e := range c.entries {
+		if e.ID == entryID {
+			return e
+		}
+	}
+	return nil
+}
+
+// find returns the entries of the feed, or of all feeds if feedID is zero, that match the filter. Entries are ordered
+// by ID, the total is the number of matching entries without the offset and limit.
+func (c *Client) find(feedID int64, filter *miniflux.Filter) *miniflux.EntryResultSet {
+	if filter == nil {
+		filter = &miniflux.Filter{}
+	}
+	var matching []*miniflux.Entry
+	for _, e := range c.entries {
+		if feedID != 0 && e.FeedID != feedID ||
+			filter.Status != "" && e.Status != filter.Status ||
+			filter.Starred && !e.Starred ||
+			filter.AfterEntryID > 0 && e.ID <= filter.AfterEntryID ||
+			filter.BeforeEntryID > 0 && e.ID >= filter.BeforeEntryID ||
+			filter.After > 0 && e.Date.Unix() <= filter.After ||
+			filter.Before > 0 && e.Date.Unix() >= filter.Before {
+			continue
+		}
+		matching = append(matching, e)
+	}
+	if filter.Direction == "desc" {
+		for i, j := 0, len(matching)-1; i < j; i, j = i+1, j-1 {
+			matching[i], matching[j] = matching[j], matching[i]
+		}
+	}
+
+	result := &miniflux.EntryResultSet{Total: len(matching), Entries: miniflux.Entries{}}
+	if offset := filter.Offset; offset > 0 {
+		if offset > len(matching) {
+			offset = len(matching)
+		}
+		matching = matching[offset:]
+	}
+	if filter.Limit > 0 && filter.Limit < len(matching) {
+		matching = matching[:filter.Limit]
+	}
+	for _, e := range matching {
+		result.Entries = append(result.Entries, c.copyEntry(e))
+	}
+	return result
+}
+
+// copyEntry returns a copy of the entry with its feed, so callers can't change the stored entries
+func (c *Client) copyEntry(e *miniflux.Entry) *miniflux.Entry {
+	entry := *e
+	entry.Feed = nil
+	for _, feed := range c.feeds {
+		if feed.ID == e.FeedID {
+			f := *feed
+			entry.Feed = &f
+		}
+	}
+	return &entry
+}
@@ -0,0 +1,93 @@
+package minifluxtest
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	miniflux "miniflux.app/client"
+)
+
+func TestFeedEntries(t *testing.T) {
+	c := NewClient()
+	c.AddFeeds(&miniflux.Feed{ID: 1, FeedURL: "https://example.com/feed.xml"})
+	c.AddEntries(
+		&miniflux.Entry{ID: 3, FeedID: 1},
+		&miniflux.Entry{ID: 1, FeedID: 1},
+		&miniflux.Entry{ID: 2, FeedID: 1, Status: miniflux.EntryStatusRead},
+		&miniflux.Entry{ID: 4, FeedID: 1},
+		&miniflux.Entry{ID: 5, FeedID: 2},
+	)
+
+	tests := []struct {
+		name      string
+		filter    *miniflux.Filter
+		wantIDs   []int64
+		wantTotal int
+	}{
+		{name: "All", filter: nil, wantIDs: []int64{1, 2, 3, 4}, wantTotal: 4},
+		{name: "Unread", filter: &miniflux.Filter{Status: miniflux.EntryStatusUnread}, wantIDs: []int64{1, 3, 4}, wantTotal: 3},
+		{name: "Limit", filter: &miniflux.Filter{Status: miniflux.EntryStatusUnread, Limit: 2}, wantIDs: []int64{1, 3}, wantTotal: 3},
+		{name: "Offset", filter: &miniflux.Filter{Offset: 3}, wantIDs: []int64{4}, wantTotal: 4},
+		{name: "After entry", filter: &miniflux.Filter{AfterEntryID: 1, Limit: 2}, wantIDs: []int64{2, 3}, wantTotal: 3},
+		{name: "Descending", filter: &miniflux.Filter{Direction: "desc", Limit: 2}, wantIDs: []int64{4, 3}, wantTotal: 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := c.FeedEntries(1, tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ids []int64
+			for _, e := range result.Entries {
+				ids = append(ids, e.ID)
+				if e.Feed == nil || e.Feed.ID != 1 {
+					t.Errorf("FeedEntries() entry %d has feed %v, want feed 1", e.ID, e.Feed)
+				}
+			}
+			if !reflect.DeepEqual(ids, tt.wantIDs) || result.Total != tt.wantTotal {
+				t.Errorf("FeedEntries() = %v (total %d), want %v (total %d)", ids, result.Total, tt.wantIDs, tt.wantTotal)
+			}
+		})
+	}
+}
+
+func TestClientUpdates(t *testing.T) {
+	c := NewClient()
+	c.AddEntries(&miniflux.Entry{ID: 1}, &miniflux.Entry{ID: 2})
+
+	errFailed := errors.New("failed")
+	c.FailNext("UpdateEntries", errFailed)
+	if err := c.UpdateEntries([]int64{1}, miniflux.EntryStatusRead); err != errFailed {
+		t.Errorf("UpdateEntries() = %v, want injected error", err)
+	}
+	if err := c.UpdateEntries([]int64{1, 99}, miniflux.EntryStatusRead); err != nil {
+		t.Errorf("UpdateEntries() = %v, want nil", err)
+	}
+	if got := c.Status(1); got != miniflux.EntryStatusRead {
+		t.Errorf("Status(1) = %q, want %q", got, miniflux.EntryStatusRead)
+	}
+	if got := c.Status(2); got != miniflux.EntryStatusUnread {
+		t.Errorf("Status(2) = %q, want %q", got, miniflux.EntryStatusUnread)
+	}
+	if got := c.Calls("UpdateEntries"); got != 2 {
+		t.Errorf("Calls(UpdateEntries) = %d, want 2", got)
+	}
+
+	if err := c.ToggleBookmark(2); err != nil || !c.Starred(2) {
+		t.Errorf("ToggleBookmark(2) = %v, starred %v, want nil and starred", err, c.Starred(2))
+	}
+	if err := c.ToggleBookmark(99); err != miniflux.ErrNotFound {
+		t.Errorf("ToggleBookmark(99) = %v, want %v", err, miniflux.ErrNotFound)
+	}
+
+	// Changing a returned entry doesn't change the stored one
+	e, err := c.Entry(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.Status = miniflux.EntryStatusRemoved
+	if got := c.Status(1); got != miniflux.EntryStatusRead {
+		t.Errorf("Status(1) = %q after changing the returned entry, want %q", got, miniflux.EntryStatusRead)
+	}
+}
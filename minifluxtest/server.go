@@ -0,0 +1,132 @@
+package minifluxtest
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+
+	"github.com/go-chi/chi"
+	miniflux "miniflux.app/client"
+)
+
+// Fixture contains the categories, feeds and entries of a Miniflux user. The categories of the feeds don't have to be
+// listed in categories.
+type Fixture struct {
+	Categories []*miniflux.Category `json:"categories"`
+	Feeds      []*miniflux.Feed     `json:"feeds"`
+	Entries    []*miniflux.Entry    `json:"entries"`
+}
+
+// LoadFixture adds the categories, feeds and entries of a JSON fixture to the client
+func (c *Client) LoadFixture(r io.Reader) error {
+	var f Fixture
+	if err := json.NewDecoder(r).Decode(&f); err != nil {
+		return err
+	}
+	c.AddCategories(f.Categories...)
+	c.AddFeeds(f.Feeds...)
+	c.AddEntries(f.Entries...)
+	return nil
+}
+
+// NewServer starts a server that implements the part of the Miniflux REST API the sidekick uses, backed by the
+// client. Any credentials are accepted. The caller has to close the server.
+func NewServer(c *Client) *httptest.Server {
+	r := chi.NewRouter()
+	r.Get("/v1/me", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, &miniflux.User{ID: 1, Username: "test"}, nil)
+	})
+	r.Get("/v1/categories", func(w http.ResponseWriter, r *http.Request) {
+		categories, err := c.Categories()
+		writeJSON(w, categories, err)
+	})
+	r.Get("/v1/feeds", func(w http.ResponseWriter, r *http.Request) {
+		feeds, err := c.Feeds()
+		writeJSON(w, feeds, err)
+	})
+	r.Get("/v1/feeds/{feedID}/entries", func(w http.ResponseWriter, r *http.Request) {
+		feedID, ok := idParam(w, r, "feedID")
+		if !ok {
+			return
+		}
+		result, err := c.FeedEntries(feedID, parseFilter(r))
+		writeJSON(w, result, err)
+	})
+	r.Get("/v1/entries", func(w http.ResponseWriter, r *http.Request) {
+		result, err := c.Entries(parseFilter(r))
+		writeJSON(w, result, err)
+	})
+	r.Put("/v1/entries", func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			EntryIDs []int64 `json:"entry_ids"`
+			Status   string  `json:"status"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			http.Error(w, `{"error_message": "invalid payload"}`, http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, nil, c.UpdateEntries(payload.EntryIDs, payload.Status))
+	})
+	r.Get("/v1/entries/{entryID}", func(w http.ResponseWriter, r *http.Request) {
+		entryID, ok := idParam(w, r, "entryID")
+		if !ok {
+			return
+		}
+		entry, err := c.Entry(entryID)
+		writeJSON(w, entry, err)
+	})
+	r.Put("/v1/entries/{entryID}/bookmark", func(w http.ResponseWriter, r *http.Request) {
+		entryID, ok := idParam(w, r, "entryID")
+		if !ok {
+			return
+		}
+		writeJSON(w, nil, c.ToggleBookmark(entryID))
+	})
+	return httptest.NewServer(r)
+}
+
+// parseFilter reads the query parameters the Miniflux client sends for a filter
+func parseFilter(r *http.Request) *miniflux.Filter {
+	q := r.URL.Query()
+	f := &miniflux.Filter{
+		Status:    q.Get("status"),
+		Order:     q.Get("order"),
+		Direction: q.Get("direction"),
+		Starred:   q.Get("starred") != "",
+		Search:    q.Get("search"),
+	}
+	f.Limit, _ = strconv.Atoi(q.Get("limit"))
+	f.Offset, _ = strconv.Atoi(q.Get("offset"))
+	f.After, _ = strconv.ParseInt(q.Get("after"), 10, 64)
+	f.Before, _ = strconv.ParseInt(q.Get("before"), 10, 64)
+	f.AfterEntryID, _ = strconv.ParseInt(q.Get("after_entry_id"), 10, 64)
+	f.BeforeEntryID, _ = strconv.ParseInt(q.Get("before_entry_id"), 10, 64)
+	return f
+}
+
+func idParam(w http.ResponseWriter, r *http.Request, name string) (int64, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, name), 10, 64)
+	if err != nil {
+		http.Error(w, `{"error_message": "invalid id"}`, http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+// writeJSON writes the value or the error like Miniflux does. Unknown resources are reported as not found, all other
+// errors as server errors.
+func writeJSON(w http.ResponseWriter, v interface{}, err error) {
+	switch {
+	case err == miniflux.ErrNotFound:
+		http.Error(w, `{"error_message": "not found"}`, http.StatusNotFound)
+	case err != nil:
+		http.Error(w, `{"error_message": "server error"}`, http.StatusInternalServerError)
+	case v == nil:
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(v)
+	}
+}
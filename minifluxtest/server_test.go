@@ -0,0 +1,43 @@
+package minifluxtest
+
+import (
+	"errors"
+	"testing"
+
+	miniflux "miniflux.app/client"
+)
+
+func TestServer(t *testing.T) {
+	c := NewClient()
+	c.AddCategories(&miniflux.Category{ID: 2, Title: "Empty"})
+	c.AddFeeds(&miniflux.Feed{ID: 1, FeedURL: "https://example.com/feed.xml", Category: &miniflux.Category{ID: 1, Title: "Tech News"}})
+	c.AddEntries(&miniflux.Entry{ID: 1, FeedID: 1, Title: "Moon"}, &miniflux.Entry{ID: 2, FeedID: 1, Title: "Sun"})
+	srv := NewServer(c)
+	defer srv.Close()
+	client := miniflux.New(srv.URL, "secret")
+
+	if _, err := client.Me(); err != nil {
+		t.Errorf("Me() returned error: %v", err)
+	}
+	categories, err := client.Categories()
+	if err != nil || len(categories) != 2 || categories[1].Title != "Tech News" {
+		t.Errorf("Categories() = %+v, %v, want the added category and the one of the feed", categories, err)
+	}
+	result, err := client.FeedEntries(1, &miniflux.Filter{Status: miniflux.EntryStatusUnread, AfterEntryID: 1, Limit: 10})
+	if err != nil || result.Total != 1 || len(result.Entries) != 1 || result.Entries[0].Title != "Sun" {
+		t.Errorf("FeedEntries() = %+v, %v, want the second entry", result, err)
+	}
+	if err := client.UpdateEntries([]int64{1}, miniflux.EntryStatusRead); err != nil || c.Status(1) != miniflux.EntryStatusRead {
+		t.Errorf("UpdateEntries() = %v, status %q, want entry 1 read", err, c.Status(1))
+	}
+	if err := client.ToggleBookmark(2); err != nil || !c.Starred(2) {
+		t.Errorf("ToggleBookmark() = %v, want entry 2 starred", err)
+	}
+	if _, err := client.Entry(99); err != miniflux.ErrNotFound {
+		t.Errorf("Entry(99) = %v, want %v", err, miniflux.ErrNotFound)
+	}
+	c.FailNext("Feeds", errors.New("failed"))
+	if _, err := client.Feeds(); err != miniflux.ErrServerError {
+		t.Errorf("Feeds() with an injected error = %v, want %v", err, miniflux.ErrServerError)
+	}
+}
@@ -0,0 +1,114 @@
+package rules
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// MaxIncludeDepth is how deeply killfiles can include other killfiles
+const MaxIncludeDepth = 8
+
+// loader reads a killfile from a local path or a URL together with all killfiles it includes. The rules of an
+// included killfile are added in place of the include line and keep their own source and line.
+type loader struct {
+	c *http.Client
+
+	// stack contains the killfiles that are being read, the first one is the killfile that was loaded
+	stack []string
+}
+
+func newLoader(c *http.Client) *loader {
+	if c == nil {
+		c = http.DefaultClient
+	}
+	return &loader{c: c}
+}
+
+// load reads the killfile at the location and the killfiles it includes
+func (l *loader) load(location string) ([]Rule, Diagnostics, error) {
+	rc, err := l.open(location)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rc.Close()
+
+	l.stack = append(l.stack, canonical(location))
+	defer func() {
+		l.stack = l.stack[:len(l.stack)-1]
+	}()
+	return parse(rc, location, l.include)
+}
+
+// include reads a killfile included by source, the location is relative to source
+func (l *loader) include(source, location string) ([]Rule, Diagnostics, error) {
+	resolved, err := resolveInclude(source, location)
+	if err != nil {
+		return nil, nil, includeError(err.Error())
+	}
+	for i, s := range l.stack {
+		if s == canonical(resolved) {
+			return nil, nil, includeError("include cycle: " + strings.Join(append(l.stack[i:len(l.stack):len(l.stack)], s), " -> "))
+		}
+	}
+	if len(l.stack) > MaxIncludeDepth {
+		return nil, nil, includeError(fmt.Sprintf("includes are nested more than %d levels deep", MaxIncludeDepth))
+	}
+	return l.load(resolved)
+}
+
+// open opens a local killfile or fetches a remote one
+func (l *loader) open(location string) (io.ReadCloser, error) {
+	if !isURL(location) {
+		return os.Open(location)
+	}
+	resp, err := l.c.Get(location)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status code %d fetching killfile %s", resp.StatusCode, location)
+	}
+	return resp.Body, nil
+}
+
+// resolveInclude resolves the location of an included killfile relative to the killfile that includes it. Remote
+// killfiles can only include other remote killfiles.
+func resolveInclude(source, location string) (string, error) {
+	if isURL(source) {
+		base, err := url.Parse(source)
+		if err != nil {
+			return "", err
+		}
+		ref, err := url.Parse(location)
+		if err != nil {
+			return "", fmt.Errorf("invalid include %q: %v", location, err)
+		}
+		resolved := base.ResolveReference(ref).String()
+		if !isURL(resolved) {
+			return "", fmt.Errorf("remote killfile can't include %q", location)
+		}
+		return resolved, nil
+	}
+	if isURL(location) || filepath.IsAbs(location) {
+		return location, nil
+	}
+	return filepath.Join(filepath.Dir(source), location), nil
+}
+
+// canonical returns the location in a form that's the same for every way to write it, so cycles are detected
+func canonical(location string) string {
+	if isURL(location) {
+		return location
+	}
+	return filepath.Clean(location)
+}
+
+func isURL(location string) bool {
+	return strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://")
+}
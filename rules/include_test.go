@@ -0,0 +1,175 @@
+package rules
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestResolveInclude(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   string
+		location string
+		want     string
+		wantErr  bool
+	}{
+		{name: "Relative path", source: "killfiles/main", location: "topics/ads", want: filepath.Join("killfiles", "topics", "ads")},
+		{name: "Parent directory", source: "killfiles/topics/ads", location: "../shared", want: filepath.Join("killfiles", "shared")},
+		{name: "Absolute path", source: "killfiles/main", location: "/etc/killfile", want: "/etc/killfile"},
+		{name: "URL from a local killfile", source: "killfiles/main", location: "https://example.com/killfile", want: "https://example.com/killfile"},
+		{name: "Relative URL", source: "https://example.com/lists/main", location: "ads", want: "https://example.com/lists/ads"},
+		{name: "Absolute URL path", source: "https://example.com/lists/main", location: "/other/ads", want: "https://example.com/other/ads"},
+		{name: "Other host", source: "https://example.com/lists/main", location: "https://example.org/ads", want: "https://example.org/ads"},
+		{name: "Local file from a remote killfile", source: "https://example.com/lists/main", location: "file:///etc/passwd", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveInclude(tt.source, tt.location)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resolveInclude() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("resolveInclude() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIncludes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "killfiles")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"main": `ignore-article * "title # Moon"
+include "topics/ads"
+include "cycle"
+include "missing-quotes
+category "Tech News" {
+	include "topics/ads"
+}
+remove-article * "title # Sun"
+`,
+		"topics/ads": `ignore-article * "title =~ Sponsor"
+include "../shared"
+`,
+		"shared": `keep-article "host:example.com" "author = Bob"
+`,
+		"cycle": `include "main"
+`,
+		"deep": `include "deep"
+`,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	main := filepath.Join(dir, "main")
+	ads := filepath.Join(dir, "topics", "ads")
+	shared := filepath.Join(dir, "shared")
+	cycle := filepath.Join(dir, "cycle")
+
+	gotRules, gotDiagnostics, err := newLoader(nil).load(main)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantRules := []Rule{
+		{Command: CommandIgnoreArticle, URL: "*", FilterExpression: "title # Moon", Source: main, Line: 1},
+		{Command: CommandIgnoreArticle, URL: "*", FilterExpression: "title =~ Sponsor", Source: ads, Line: 1},
+		{Command: CommandKeepArticle, URL: "host:example.com", FilterExpression: "author = Bob", Source: shared, Line: 1},
+		{Command: CommandRemoveArticle, URL: "*", FilterExpression: "title # Sun", Source: main, Line: 8},
+	}
+	if !reflect.DeepEqual(gotRules, wantRules) {
+		t.Errorf("load() rules = %+v, want %+v", gotRules, wantRules)
+	}
+	wantDiagnostics := Diagnostics{
+		{Source: cycle, Line: 1, Column: 10, Message: "include cycle: " + main + " -> " + cycle + " -> " + main, Text: `include "main"`},
+		{Source: main, Line: 4, Column: 9, Message: "unterminated location of the include", Text: `include "missing-quotes`},
+		{Source: main, Line: 6, Column: 1, Message: "include within a category block", Text: `include "topics/ads"`},
+	}
+	if !reflect.DeepEqual(gotDiagnostics, wantDiagnostics) {
+		t.Errorf("load() diagnostics = %+v, want %+v", gotDiagnostics, wantDiagnostics)
+	}
+
+	// A killfile that includes itself is a cycle as well
+	_, gotDiagnostics, err = newLoader(nil).load(filepath.Join(dir, "deep"))
+	if err != nil || len(gotDiagnostics) != 1 || !strings.HasPrefix(gotDiagnostics[0].Message, "include cycle") {
+		t.Errorf("load() of a killfile that includes itself = %+v, %v, want an include cycle", gotDiagnostics, err)
+	}
+
+	// An include that can't be read fails the whole killfile, so a refresh keeps the previous rules
+	if err := ioutil.WriteFile(cycle, []byte(`include "does-not-exist"`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := newLoader(nil).load(main); err == nil || !strings.Contains(err.Error(), cycle+":1:") {
+		t.Errorf("load() with a missing include = %v, want error of line 1 of %s", err, cycle)
+	}
+}
+
+func TestIncludeDepth(t *testing.T) {
+	// Every killfile includes the next one, level-0 includes level-1 and so on
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var level int
+		if _, err := fmt.Sscanf(r.URL.Path, "/level-%d", &level); err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintf(w, "ignore-article * \"title # Level%d\"\ninclude \"level-%d\"\n", level, level+1)
+	}))
+	defer srv.Close()
+
+	rules, diagnostics, err := newLoader(srv.Client()).load(srv.URL + "/level-0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != MaxIncludeDepth+1 {
+		t.Errorf("load() = %d rules, want %d", len(rules), MaxIncludeDepth+1)
+	}
+	if want := fmt.Sprintf("%s/level-%d", srv.URL, MaxIncludeDepth); len(diagnostics) != 1 || diagnostics[0].Source != want {
+		t.Errorf("load() diagnostics = %+v, want one for the include of %s", diagnostics, want)
+	}
+	if got := rules[len(rules)-1].Source; got != fmt.Sprintf("%s/level-%d", srv.URL, MaxIncludeDepth) {
+		t.Errorf("load() last rule from %s, want the killfile with the maximum depth", got)
+	}
+}
+
+func TestRepositoryIncludeClient(t *testing.T) {
+	// The server's certificate is only trusted by its own client, so the include fails with any other client
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `ignore-article * "title # Sponsor"`)
+	}))
+	defer srv.Close()
+
+	local, err := ioutil.TempFile("", "killfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(local.Name())
+	fmt.Fprintf(local, "include %q\n", srv.URL+"/sponsors")
+	local.Close()
+
+	rr, err := NewRepository(srv.Client(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rr.RefreshRules(local.Name()); err != nil {
+		t.Fatalf("RefreshRules() = %v, want the included killfile to be fetched with the client of the repository", err)
+	}
+	if got := rr.Rules(); len(got) != 1 || got[0].Source != srv.URL+"/sponsors" {
+		t.Errorf("Rules() = %+v, want the rule of the included killfile", got)
+	}
+}
@@ -0,0 +1,141 @@
+package rules
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dewey/miniflux-sidekick/expr"
+)
+
+// String returns the rule in killfile format
+func (r Rule) String() string {
+	feed := `"` + r.URL + `"`
+	if strings.Contains(r.URL, `"`) {
+		// The value of the selector is quoted already, like category:"Tech News"
+		feed = r.URL
+	}
+	return fmt.Sprintf(`%s %s "%s"`, r.Command, feed, strings.Replace(r.FilterExpression, `"`, `\"`, -1))
+}
+
+// location returns where a rule is defined, relative to the rule it's compared to
+func (r Rule) location(other Rule) string {
+	if r.Source == other.Source {
+		return fmt.Sprintf("line %d", r.Line)
+	}
+	return fmt.Sprintf("%s:%d", r.Source, r.Line)
+}
+
+// Lint checks rules for problems: invalid filter expressions, like a list of terms with an empty term that would match
+// every entry, duplicate rules and rules for a specific feed or category that can never match anything a wildcard rule
+// of the same command doesn't already match. The order of the rules doesn't matter for shadowing as all rules are
+// evaluated, a wildcard rule shadows rules before it as well.
+func Lint(rules []Rule) Diagnostics {
+	type lintRule struct {
+		Rule
+		normalized string
+		node       expr.Node
+	}
+	var (
+		diagnostics Diagnostics
+		valid       []lintRule
+	)
+	for _, rule := range rules {
+		node, err := expr.Parse(rule.FilterExpression)
+		if err != nil {
+			diagnostics = append(diagnostics, lintDiagnostic(rule, "invalid filter expression: "+errorMessage(err)))
+			continue
+		}
+		valid = append(valid, lintRule{Rule: rule, normalized: node.String(), node: node})
+	}
+
+	for i, current := range valid {
+		var message string
+		for _, previous := range valid[:i] {
+			if previous.Command == current.Command && previous.URL == current.URL &&
+				previous.Scope() == current.Scope() && previous.normalized == current.normalized {
+				message = "duplicate of the rule on " + previous.location(current.Rule)
+				break
+			}
+		}
+		for j, wildcard := range valid {
+			if message != "" {
+				break
+			}
+			if j == i || wildcard.Command != current.Command || wildcard.URL != "*" {
+				continue
+			}
+			// A wildcard rule outside of category blocks covers the rules of all blocks, one within a block only the
+			// rules of the same block
+			sameScope := wildcard.Scope() == current.Scope()
+			covers := !wildcard.Scoped() || sameScope
+			narrower := current.URL != "*" || !sameScope
+			if covers && narrower && implies(current.node, wildcard.node) {
+				message = "shadowed by the wildcard rule on " + wildcard.location(current.Rule)
+			}
+		}
+		if message != "" {
+			diagnostics = append(diagnostics, lintDiagnostic(current.Rule, message))
+		}
+	}
+	return diagnostics
+}
+
+func lintDiagnostic(rule Rule, message string) Diagnostic {
+	return Diagnostic{
+		Source:  rule.Source,
+		Line:    rule.Line,
+		Column:  1,
+		Message: message,
+		Text:    rule.String(),
+	}
+}
+
+// implies reports whether every entry matching a also matches b. It only looks at the structure of the expressions:
+// a implies b if every alternative of a contains all comparisons of one of the alternatives of b.
+func implies(a, b expr.Node) bool {
+	for _, ac := range disjunction(a) {
+		var found bool
+		for _, bc := range disjunction(b) {
+			if containsAll(ac, bc) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// disjunction splits an expression into the alternatives of its top level "or", every alternative is a list of the
+// normalized expressions combined with "and".
+func disjunction(n expr.Node) [][]string {
+	if or, ok := n.(*expr.Or); ok {
+		return append(disjunction(or.Left), disjunction(or.Right)...)
+	}
+	return [][]string{conjunction(n)}
+}
+
+func conjunction(n expr.Node) []string {
+	if and, ok := n.(*expr.And); ok {
+		return append(conjunction(and.Left), conjunction(and.Right)...)
+	}
+	return []string{n.String()}
+}
+
+func containsAll(set, subset []string) bool {
+	for _, s := range subset {
+		var found bool
+		for _, t := range set {
+			if s == t {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,52 @@
+package rules
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLint(t *testing.T) {
+	killfile := `ignore-article * "title # Moon"
+ignore-article "https://xkcd.com/atom.xml" "title # Moon and author = Bob"
+ignore-article "https://xkcd.com/atom.xml" "title # Sun or title # Moon"
+ignore-article * "(title # Moon)"
+ignore-article "https://example.com" "title =~ Sponsor"
+ignore-article "https://example.com" "title =~ \"Sponsor\""
+ignore-article "https://example.org" "title =~ Sponsor"
+category "Tech News" {
+	ignore-article * "title # Moon and author = Bob"
+	ignore-article * "title =~ Sponsor"
+	ignore-article "https://example.com" "title =~ Sponsor"
+}
+category "Sports" {
+	ignore-article * "title =~ Sponsor"
+}
+ignore-article "https://a.com/feed" "title # Comet"
+ignore-article * "title # Comet"
+`
+	parsedRules, diagnostics, err := Parse(strings.NewReader(killfile), "killfile")
+	if err != nil || diagnostics != nil {
+		t.Fatal(err, diagnostics)
+	}
+	// Parse skips a rule with an empty term as it would match every entry, Lint has to report it for other rules too
+	parsedRules = append(parsedRules, Rule{Command: CommandIgnoreArticle, URL: "*", FilterExpression: "title # Lunar,Moon,", Source: "killfile", Line: 18})
+
+	var got []string
+	for _, d := range Lint(parsedRules) {
+		got = append(got, d.String())
+	}
+	// Invalid filter expressions are reported before the other problems
+	want := []string{
+		`killfile:18:1: invalid filter expression: "Lunar,Moon," contains an empty term, it would match every entry: ignore-article "*" "title # Lunar,Moon,"`,
+		`killfile:2:1: shadowed by the wildcard rule on line 1: ignore-article "https://xkcd.com/atom.xml" "title # Moon and author = Bob"`,
+		`killfile:4:1: duplicate of the rule on line 1: ignore-article "*" "(title # Moon)"`,
+		`killfile:6:1: duplicate of the rule on line 5: ignore-article "https://example.com" "title =~ \"Sponsor\""`,
+		`killfile:9:1: shadowed by the wildcard rule on line 1: ignore-article "*" "title # Moon and author = Bob"`,
+		`killfile:11:1: shadowed by the wildcard rule on line 10: ignore-article "https://example.com" "title =~ Sponsor"`,
+		`killfile:16:1: shadowed by the wildcard rule on line 17: ignore-article "https://a.com/feed" "title # Comet"`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Lint() = %q, want %q", got, want)
+	}
+}
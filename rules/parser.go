@@ -0,0 +1,360 @@
+package rules
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/dewey/miniflux-sidekick/expr"
+)
+
+// Diagnostic describes an invalid line of a killfile
+type Diagnostic struct {
+	Source  string
+	Line    int
+	Column  int
+	Message string
+	Text    string
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s:%d:%d: %s: %s", d.Source, d.Line, d.Column, d.Message, d.Text)
+}
+
+// Diagnostics is returned if one or more lines of a killfile are invalid
+type Diagnostics []Diagnostic
+
+func (d Diagnostics) Error() string {
+	switch len(d) {
+	case 0:
+		return "no invalid lines"
+	case 1:
+		return d[0].String()
+	}
+	return fmt.Sprintf("%s (and %d more invalid lines)", d[0].String(), len(d)-1)
+}
+
+// commands contains all killfile commands we support
+var commands = map[string]bool{
+	CommandIgnoreArticle: true,
+	CommandRemoveArticle: true,
+	CommandStarArticle:   true,
+	CommandReportArticle: true,
+	CommandKeepArticle:   true,
+}
+
+// block is a category block of a killfile, the rules within it only apply to the feeds of the category
+type block struct {
+	category   string
+	categoryID int64
+	line       int
+	text       string
+	invalid    bool
+}
+
+// Parse reads a killfile with one rule per line. Blank lines and lines starting with # are skipped. Invalid lines are
+// not part of the returned rules, there's a diagnostic for each of them instead. The source is used for diagnostics
+// and the provenance of the rules.
+//
+// Rules can be grouped in category blocks that start with `category "<title>" {` or `category id:<id> {` and end
+// with `}`, these rules only apply to the feeds of the Miniflux category. The rules of an invalid block are skipped.
+//
+// Includes are only supported in killfiles that are read from a path or URL by a repository, Parse reports them as
+// invalid lines.
+func Parse(r io.Reader, source string) ([]Rule, Diagnostics, error) {
+	return parse(r, source, nil)
+}
+
+// includeFunc returns the rules of a killfile included by source. An includeError is reported as a diagnostic of the
+// include line, all other errors stop the parsing.
+type includeFunc func(source, location string) ([]Rule, Diagnostics, error)
+
+// includeError is a problem with an include line, like an include cycle
+type includeError string
+
+func (e includeError) Error() string {
+	return string(e)
+}
+
+func parse(r io.Reader, source string, include includeFunc) ([]Rule, Diagnostics, error) {
+	var (
+		rules       []Rule
+		diagnostics Diagnostics
+		lineNumber  int
+		current     *block
+	)
+	diagnose := func(line, column int, message, text string) {
+		diagnostics = append(diagnostics, Diagnostic{
+			Source:  source,
+			Line:    line,
+			Column:  column,
+			Message: message,
+			Text:    text,
+		})
+	}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		lineNumber++
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if trimmed == "}" {
+			if current == nil {
+				diagnose(lineNumber, strings.IndexByte(line, '}')+1, "unexpected } outside of a category block", trimmed)
+			}
+			current = nil
+			continue
+		}
+		if hasKeyword(line, "include") {
+			location, column, err := parseInclude(line)
+			switch {
+			case err != nil:
+				diagnose(lineNumber, column, err.Error(), trimmed)
+				continue
+			case current != nil:
+				diagnose(lineNumber, 1, "include within a category block", trimmed)
+				continue
+			case include == nil:
+				diagnose(lineNumber, 1, "include is only supported in killfiles read from a path or URL", trimmed)
+				continue
+			}
+			included, d, err := include(source, location)
+			if ie, ok := err.(includeError); ok {
+				diagnose(lineNumber, column, ie.Error(), trimmed)
+				continue
+			}
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s:%d: %v", source, lineNumber, err)
+			}
+			rules = append(rules, included...)
+			diagnostics = append(diagnostics, d...)
+			continue
+		}
+		if hasKeyword(line, "category") {
+			if current != nil {
+				diagnose(lineNumber, 1, fmt.Sprintf("category block within the category block on line %d", current.line), trimmed)
+				continue
+			}
+			b, column, err := parseBlockStart(line)
+			if err != nil {
+				diagnose(lineNumber, column, err.Error(), trimmed)
+				b.invalid = true
+			}
+			b.line = lineNumber
+			b.text = trimmed
+			current = &b
+			continue
+		}
+		if current != nil && current.invalid {
+			continue
+		}
+		rule, column, err := parseLine(line)
+		if err != nil {
+			diagnose(lineNumber, column, err.Error(), trimmed)
+			continue
+		}
+		rule.Source = source
+		rule.Line = lineNumber
+		if current != nil {
+			rule.Category = current.category
+			rule.CategoryID = current.categoryID
+		}
+		rules = append(rules, rule)
+	}
+	if current != nil {
+		diagnose(current.line, 1, "unterminated category block", current.text)
+	}
+	return rules, diagnostics, scanner.Err()
+}
+
+// hasKeyword reports whether the first word of the line is the keyword, like category for the start of a block
+func hasKeyword(line, keyword string) bool {
+	trimmed := strings.TrimLeft(line, " \t")
+	return strings.HasPrefix(trimmed, keyword) && (len(trimmed) == len(keyword) || isSpace(trimmed[len(keyword)]))
+}
+
+// parseInclude parses an include of the format `include "<path-or-url>"`. On error the 1-based column of the problem
+// is returned, otherwise the column of the location.
+func parseInclude(line string) (string, int, error) {
+	pos := skipSpace(line, skipSpace(line, 0)+len("include"))
+	if pos >= len(line) {
+		return "", pos + 1, fmt.Errorf("missing location of the include")
+	}
+	if line[pos] != '"' {
+		return "", pos + 1, fmt.Errorf("location of the include has to be quoted")
+	}
+	end := strings.IndexByte(line[pos+1:], '"')
+	if end < 0 {
+		return "", pos + 1, fmt.Errorf("unterminated location of the include")
+	}
+	location := line[pos+1 : pos+1+end]
+	if location == "" {
+		return "", pos + 1, fmt.Errorf("missing location of the include")
+	}
+	if after := skipSpace(line, pos+end+2); after < len(strings.TrimRight(line, " \t\r")) {
+		return "", after + 1, fmt.Errorf("unexpected text after the include")
+	}
+	return location, pos + 2, nil
+}
+
+// parseBlockStart parses the start of a category block of the format `category "<title>" {` or
+// `category id:<id> {`. On error the 1-based column of the problem is returned.
+func parseBlockStart(line string) (block, int, error) {
+	var b block
+	pos := skipSpace(line, 0) + len("category")
+	pos = skipSpace(line, pos)
+	if pos >= len(line) || line[pos] == '{' {
+		return b, pos + 1, fmt.Errorf("missing category")
+	}
+	start := pos
+	if line[pos] == '"' {
+		end := strings.IndexByte(line[pos+1:], '"')
+		if end < 0 {
+			return b, pos + 1, fmt.Errorf("unterminated category")
+		}
+		b.category = line[pos+1 : pos+1+end]
+		pos += end + 2
+		if b.category == "" {
+			return b, start + 1, fmt.Errorf("missing category")
+		}
+	} else {
+		for pos < len(line) && !isSpace(line[pos]) && line[pos] != '{' {
+			pos++
+		}
+		value := line[start:pos]
+		if !strings.HasPrefix(value, "id:") {
+			return b, start + 1, fmt.Errorf("category has to be quoted or an ID like id:42")
+		}
+		id, err := strconv.ParseInt(strings.TrimPrefix(value, "id:"), 10, 64)
+		if err != nil || id <= 0 {
+			return b, start + 1, fmt.Errorf("invalid category ID %q", strings.TrimPrefix(value, "id:"))
+		}
+		b.categoryID = id
+	}
+	pos = skipSpace(line, pos)
+	if pos >= len(line) || line[pos] != '{' {
+		return b, pos + 1, fmt.Errorf("missing { after the category")
+	}
+	if after := skipSpace(line, pos+1); strings.TrimSpace(line[after:]) != "" {
+		return b, after + 1, fmt.Errorf("unexpected text after {")
+	}
+	return b, 0, nil
+}
+
+// parseLine parses a rule of the format `<command> "<feed>" "<filterexpr>"`. The feed can be unquoted if it doesn't
+// contain spaces, like the wildcard selector, or if only its value is quoted, like category:"Tech News". Everything between the first and the last quote of the filter
+// expression belongs to it, a quote within can be escaped as \". On error the 1-based column of the problem is returned.
+func parseLine(line string) (Rule, int, error) {
+	pos := skipSpace(line, 0)
+
+	// Command
+	start := pos
+	for pos < len(line) && !isSpace(line[pos]) {
+		pos++
+	}
+	command := line[start:pos]
+	if !commands[command] {
+		return Rule{}, start + 1, fmt.Errorf("unknown command %q", command)
+	}
+
+	// Feed
+	pos = skipSpace(line, pos)
+	if pos >= len(line) {
+		return Rule{}, pos + 1, fmt.Errorf("missing feed")
+	}
+	var feed string
+	start = pos
+	if line[pos] == '"' {
+		end := strings.IndexByte(line[pos+1:], '"')
+		if end < 0 {
+			return Rule{}, pos + 1, fmt.Errorf("unterminated feed")
+		}
+		feed = line[pos+1 : pos+1+end]
+		pos += end + 2
+	} else {
+		start = pos
+		for pos < len(line) && !isSpace(line[pos]) {
+			if line[pos] == '"' {
+				end := strings.IndexByte(line[pos+1:], '"')
+				if end < 0 {
+					return Rule{}, pos + 1, fmt.Errorf("unterminated feed")
+				}
+				pos += end + 1
+			}
+			pos++
+		}
+		feed = line[start:pos]
+	}
+	if feed == "" {
+		return Rule{}, pos + 1, fmt.Errorf("missing feed")
+	}
+	if _, err := ParseSelector(feed); err != nil {
+		return Rule{}, start + 1, err
+	}
+
+	// Filter expression
+	pos = skipSpace(line, pos)
+	rest := strings.TrimRight(line[pos:], " \t\r")
+	if rest == "" {
+		return Rule{}, pos + 1, fmt.Errorf("missing filter expression")
+	}
+	if len(rest) < 2 || rest[0] != '"' || rest[len(rest)-1] != '"' {
+		return Rule{}, pos + 1, fmt.Errorf("filter expression has to be quoted")
+	}
+	expression, columns := unescapeQuotes(rest[1:len(rest)-1], pos+2)
+	if _, err := expr.Parse(expression); err != nil {
+		column := pos + 2
+		if se, ok := err.(*expr.SyntaxError); ok && se.Offset < len(columns) {
+			column = columns[se.Offset]
+		} else if ok {
+			column += len(rest) - 2
+		}
+		return Rule{}, column, fmt.Errorf("invalid filter expression: %s", errorMessage(err))
+	}
+
+	return Rule{
+		Command:          command,
+		URL:              feed,
+		FilterExpression: expression,
+	}, 0, nil
+}
+
+// unescapeQuotes replaces \" with a quote. It returns the column in the line for every byte of the result, the
+// first byte starts at column.
+func unescapeQuotes(s string, column int) (string, []int) {
+	var (
+		b       strings.Builder
+		columns []int
+	)
+	for i := 0; i < len(s); i++ {
+		columns = append(columns, column+i)
+		if s[i] == '\\' && i+1 < len(s) && s[i+1] == '"' {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String(), columns
+}
+
+// errorMessage strips the offset from syntax errors as the column is part of the diagnostic already
+func errorMessage(err error) string {
+	if se, ok := err.(*expr.SyntaxError); ok {
+		return se.Msg
+	}
+	return err.Error()
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t'
+}
+
+func skipSpace(s string, pos int) int {
+	for pos < len(s) && isSpace(s[pos]) {
+		pos++
+	}
+	return pos
+}
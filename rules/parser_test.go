@@ -0,0 +1,150 @@
+package rules
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	killfile := `# Sponsored posts
+ignore-article "https://www.example.com" "title =~ \[Weekly\sSponsor\]"
+
+ignore-article "https://xkcd.com/atom.xml" "title # Lunar,Moon"
+ignore-article * "title =~ \"Sponsor\" and author = \"Bob\""
+	# indented comment
+ignore-articel * "title # Moon"
+ignore-article * title # Moon
+ignore-article "https://xkcd.com/atom.xml" "titel # Moon"
+ignore-article
+ignore-article * "(title # Moon"
+ignore-article category:"Tech News" "title # Moon"
+ignore-article "id:x" "title # Moon"
+`
+	gotRules, gotDiagnostics, err := Parse(strings.NewReader(killfile), "killfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantRules := []Rule{
+		{
+			Command:          "ignore-article",
+			URL:              "https://www.example.com",
+			FilterExpression: `title =~ \[Weekly\sSponsor\]`,
+			Source:           "killfile",
+			Line:             2,
+		},
+		{
+			Command:          "ignore-article",
+			URL:              "https://xkcd.com/atom.xml",
+			FilterExpression: "title # Lunar,Moon",
+			Source:           "killfile",
+			Line:             4,
+		},
+		{
+			Command:          "ignore-article",
+			URL:              "*",
+			FilterExpression: `title =~ "Sponsor" and author = "Bob"`,
+			Source:           "killfile",
+			Line:             5,
+		},
+		{
+			Command:          "ignore-article",
+			URL:              `category:"Tech News"`,
+			FilterExpression: "title # Moon",
+			Source:           "killfile",
+			Line:             12,
+		},
+	}
+	if !reflect.DeepEqual(gotRules, wantRules) {
+		t.Errorf("Parse() rules = %+v, want %+v", gotRules, wantRules)
+	}
+
+	wantDiagnostics := Diagnostics{
+		{Source: "killfile", Line: 7, Column: 1, Message: `unknown command "ignore-articel"`, Text: `ignore-articel * "title # Moon"`},
+		{Source: "killfile", Line: 8, Column: 18, Message: "filter expression has to be quoted", Text: "ignore-article * title # Moon"},
+		{Source: "killfile", Line: 9, Column: 45, Message: `invalid filter expression: unknown attribute "titel"`, Text: `ignore-article "https://xkcd.com/atom.xml" "titel # Moon"`},
+		{Source: "killfile", Line: 10, Column: 15, Message: "missing feed", Text: "ignore-article"},
+		{Source: "killfile", Line: 11, Column: 32, Message: "invalid filter expression: unexpected end of expression", Text: `ignore-article * "(title # Moon"`},
+		{Source: "killfile", Line: 13, Column: 16, Message: `invalid feed ID "x"`, Text: `ignore-article "id:x" "title # Moon"`},
+	}
+	if !reflect.DeepEqual(gotDiagnostics, wantDiagnostics) {
+		t.Errorf("Parse() diagnostics = %+v, want %+v", gotDiagnostics, wantDiagnostics)
+	}
+}
+
+func TestParseColumnWithEscapedQuotes(t *testing.T) {
+	_, diagnostics, err := Parse(strings.NewReader(`ignore-article * "title = \"Sun\" and foo = bar"`), "killfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diagnostics) != 1 {
+		t.Fatalf("Parse() diagnostics = %+v, want 1", diagnostics)
+	}
+	// The column points at "foo" in the original line, not in the unescaped filter expression
+	if diagnostics[0].Column != 39 {
+		t.Errorf("Parse() column = %d, want 39", diagnostics[0].Column)
+	}
+}
+
+func TestParseCategoryBlocks(t *testing.T) {
+	killfile := `category "Tech News" {
+	ignore-article * "title # Moon"
+	# comment
+}
+category id:12 {
+	ignore-article "host:example.com" "title # Sun"
+}
+ignore-article * "title # Stars"
+}
+category Tech {
+	ignore-article * "title # Comet"
+}
+category id:1 {
+	category id:2 {
+`
+	gotRules, gotDiagnostics, err := Parse(strings.NewReader(killfile), "killfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantRules := []Rule{
+		{Command: "ignore-article", URL: "*", FilterExpression: "title # Moon", Category: "Tech News", Source: "killfile", Line: 2},
+		{Command: "ignore-article", URL: "host:example.com", FilterExpression: "title # Sun", CategoryID: 12, Source: "killfile", Line: 6},
+		{Command: "ignore-article", URL: "*", FilterExpression: "title # Stars", Source: "killfile", Line: 8},
+	}
+	if !reflect.DeepEqual(gotRules, wantRules) {
+		t.Errorf("Parse() rules = %+v, want %+v", gotRules, wantRules)
+	}
+
+	wantDiagnostics := Diagnostics{
+		{Source: "killfile", Line: 9, Column: 1, Message: "unexpected } outside of a category block", Text: "}"},
+		{Source: "killfile", Line: 10, Column: 10, Message: "category has to be quoted or an ID like id:42", Text: "category Tech {"},
+		{Source: "killfile", Line: 14, Column: 1, Message: "category block within the category block on line 13", Text: "category id:2 {"},
+		{Source: "killfile", Line: 13, Column: 1, Message: "unterminated category block", Text: "category id:1 {"},
+	}
+	if !reflect.DeepEqual(gotDiagnostics, wantDiagnostics) {
+		t.Errorf("Parse() diagnostics = %+v, want %+v", gotDiagnostics, wantDiagnostics)
+	}
+}
+
+func TestDiagnosticsError(t *testing.T) {
+	d := Diagnostic{Source: "killfile", Line: 2, Column: 19, Message: "invalid filter expression", Text: "title # Moon,"}
+	tests := []struct {
+		name        string
+		diagnostics Diagnostics
+		want        string
+	}{
+		{name: "Nil", want: "no invalid lines"},
+		{name: "Empty", diagnostics: Diagnostics{}, want: "no invalid lines"},
+		{name: "One", diagnostics: Diagnostics{d}, want: "killfile:2:19: invalid filter expression: title # Moon,"},
+		{name: "Several", diagnostics: Diagnostics{d, d, d}, want: "killfile:2:19: invalid filter expression: title # Moon, (and 2 more invalid lines)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.diagnostics.Error(); got != tt.want {
+				t.Errorf("Error() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
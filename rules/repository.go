@@ -0,0 +1,38 @@
+package rules
+
+import (
+	"net/http"
+)
+
+type repository struct {
+	c      *http.Client
+	strict bool
+	cache
+}
+
+// NewRepository returns a newly initialized rules repository for a local killfile or a remote one. Remote killfiles,
+// also those that are included by local ones, are fetched with the client or with http.DefaultClient if it's nil. A
+// strict repository refuses to use a killfile with invalid lines.
+func NewRepository(c *http.Client, strict bool) (Repository, error) {
+	return &repository{
+		c:      c,
+		strict: strict,
+	}, nil
+}
+
+// FetchRules reads a local killfile or fetches a remote one and the killfiles it includes to get all rules
+func (r *repository) FetchRules(location string) ([]Rule, error) {
+	rules, diagnostics, err := newLoader(r.c).load(location)
+	if err != nil {
+		return nil, err
+	}
+	if diagnostics != nil {
+		return rules, diagnostics
+	}
+	return rules, nil
+}
+
+// RefreshRules reads the killfile again and updates the local cache
+func (r *repository) RefreshRules(location string) error {
+	return refresh(r, location, r.strict)
+}
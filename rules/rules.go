@@ -1,26 +1,65 @@
 package rules
 
-import (
-	"regexp"
-)
-
-var (
-	reRuleSplitter = regexp.MustCompile(`(.+?)\s\"?(.+?)\"?\s\"(.+)\"`)
-)
+import "fmt"
 
 // Repository defines the interface for the rules repository
 type Repository interface {
-	// FetchRules fetches the list of rules from a file or remote location
+	// FetchRules fetches the list of rules from a file or remote location. If some of the lines are invalid the valid
+	// rules are returned together with Diagnostics for the invalid lines.
 	FetchRules(location string) ([]Rule, error)
 
-	// RefreshRules refreshes the in-memory cached rules
+	// RefreshRules refreshes the in-memory cached rules. Invalid lines are returned as Diagnostics, the valid rules
+	// are still used unless the repository is strict.
 	RefreshRules(location string) error
 
-	// SetCachedRules([]Rule)
+	// SetCachedRules compiles the rules and replaces the in-memory cache
 	SetCachedRules(rules []Rule)
 
 	// Rules returns rules from cache
 	Rules() []Rule
+
+	// RuleSet returns the compiled rules from cache
+	RuleSet() *RuleSet
+}
+
+// Commands supported in killfiles
+const (
+	// CommandIgnoreArticle marks matching entries as read
+	CommandIgnoreArticle = "ignore-article"
+	// CommandRemoveArticle marks matching entries as removed
+	CommandRemoveArticle = "remove-article"
+	// CommandStarArticle stars matching entries
+	CommandStarArticle = "star-article"
+	// CommandReportArticle leaves matching entries unread and only reports them
+	CommandReportArticle = "report-article"
+	// CommandKeepArticle protects matching entries from all rules that mark them as read or removed
+	CommandKeepArticle = "keep-article"
+)
+
+// Action is what happens to an entry that matches a rule
+type Action string
+
+// Actions of the commands, in the order they are applied
+const (
+	ActionRemove Action = "remove"
+	ActionRead   Action = "read"
+	ActionStar   Action = "star"
+	ActionReport Action = "report"
+)
+
+// Actions contains all actions in the order they are applied
+var Actions = []Action{ActionRemove, ActionRead, ActionStar, ActionReport}
+
+var commandActions = map[string]Action{
+	CommandIgnoreArticle: ActionRead,
+	CommandRemoveArticle: ActionRemove,
+	CommandStarArticle:   ActionStar,
+	CommandReportArticle: ActionReport,
+}
+
+// Kills reports whether the action hides an entry from the user, keep rules protect entries from these actions
+func (a Action) Kills() bool {
+	return a == ActionRead || a == ActionRemove
 }
 
 // Rule contains a killfile rule. There's no official standard so we implement these rules https://newsboat.org/releases/2.15/docs/newsboat.html#_killfiles
@@ -28,4 +67,50 @@ type Rule struct {
 	Command          string
 	URL              string
 	FilterExpression string
+
+	// Category or CategoryID is set if the rule is defined in a category block, it only applies to the feeds of the
+	// Miniflux category with this title or ID then
+	Category   string
+	CategoryID int64
+
+	// Source is the killfile the rule was defined in and Line the line number within it
+	Source string
+	Line   int
+
+	// Origin is the name of the killfile source the rule was merged from, it's empty for a single killfile
+	Origin string
+}
+
+// Action returns the action of the rule's command, keep rules don't have an action
+func (r Rule) Action() (Action, bool) {
+	a, ok := commandActions[r.Command]
+	return a, ok
+}
+
+// Scoped reports whether the rule is defined in a category block
+func (r Rule) Scoped() bool {
+	return r.Category != "" || r.CategoryID != 0
+}
+
+// Scope returns the category block of the rule as it's written in the killfile, it's empty if the rule isn't scoped
+func (r Rule) Scope() string {
+	switch {
+	case r.CategoryID != 0:
+		return fmt.Sprintf("category id:%d", r.CategoryID)
+	case r.Category != "":
+		return fmt.Sprintf(`category "%s"`, r.Category)
+	}
+	return ""
+}
+
+// refresh fetches the rules and updates the cache. In strict mode the cache is only updated if all lines are valid.
+func refresh(r Repository, location string, strict bool) error {
+	rules, err := r.FetchRules(location)
+	if err != nil {
+		if _, ok := err.(Diagnostics); !ok || strict {
+			return err
+		}
+	}
+	r.SetCachedRules(rules)
+	return err
 }
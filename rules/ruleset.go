@@ -0,0 +1,199 @@
+package rules
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"github.com/dewey/miniflux-sidekick/expr"
+	miniflux "miniflux.app/client"
+)
+
+// CompiledRule is a rule with its parsed feed selector and filter expression. Index is the position of the rule in
+// the rule set.
+type CompiledRule struct {
+	Rule
+	Index      int
+	Selector   Selector
+	Expression expr.Node
+
+	// categoryID is the ID the category of a scoped rule was resolved to, it's -1 if there's no such category
+	categoryID int64
+}
+
+// MatchesFeed checks if the feed is in the category of the rule's block and matches its feed selector
+func (r CompiledRule) MatchesFeed(feed *miniflux.Feed) bool {
+	return r.matchesCategory(feed) && r.Selector.Matches(feed)
+}
+
+// matchesCategory checks if the feed is in the category of the rule's block. Until the rule set is resolved the
+// category is compared with the category the feed belongs to.
+func (r CompiledRule) matchesCategory(feed *miniflux.Feed) bool {
+	if !r.Scoped() {
+		return true
+	}
+	if feed == nil || feed.Category == nil {
+		return false
+	}
+	switch {
+	case r.categoryID != 0:
+		return feed.Category.ID == r.categoryID
+	case r.CategoryID != 0:
+		return feed.Category.ID == r.CategoryID
+	}
+	return strings.EqualFold(feed.Category.Title, r.Category)
+}
+
+// InvalidRule is a rule with a feed selector or filter expression that couldn't be parsed
+type InvalidRule struct {
+	Rule
+	Err error
+}
+
+// RuleSet is an immutable set of rules with their filter expressions parsed and regular expressions compiled. It's
+// built once every time the rules are updated and can be shared between goroutines.
+type RuleSet struct {
+	rules    []Rule
+	compiled []CompiledRule
+	invalid  []InvalidRule
+	checksum string
+	volatile bool
+	scoped   bool
+}
+
+// NewRuleSet compiles the given rules. Rules with invalid feed selectors or filter expressions are not part of the
+// compiled rules but are returned by Invalid.
+func NewRuleSet(rules []Rule) *RuleSet {
+	rs := &RuleSet{
+		rules: rules,
+	}
+	for i, rule := range rules {
+		selector, err := ParseSelector(rule.URL)
+		if err != nil {
+			rs.invalid = append(rs.invalid, InvalidRule{Rule: rule, Err: err})
+			continue
+		}
+		node, err := expr.Parse(rule.FilterExpression)
+		if err != nil {
+			rs.invalid = append(rs.invalid, InvalidRule{Rule: rule, Err: err})
+			continue
+		}
+		rs.compiled = append(rs.compiled, CompiledRule{Rule: rule, Index: i, Selector: selector, Expression: node})
+		rs.volatile = rs.volatile || expr.Volatile(node)
+		rs.scoped = rs.scoped || rule.Scoped()
+	}
+	rs.checksum = checksum(rules)
+	return rs
+}
+
+// checksum identifies the rules by what they do, moving a rule to another line or file doesn't change it
+func checksum(rules []Rule) string {
+	h := sha256.New()
+	for _, rule := range rules {
+		line := rule.Command + "\x00" + rule.URL + "\x00" + rule.FilterExpression
+		if rule.Scoped() {
+			line += "\x00" + rule.Scope()
+		}
+		h.Write([]byte(line + "\n"))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Rules returns all rules the set was built from
+func (rs *RuleSet) Rules() []Rule {
+	return rs.rules
+}
+
+// Compiled returns all rules with a valid feed selector and filter expression
+func (rs *RuleSet) Compiled() []CompiledRule {
+	return rs.compiled
+}
+
+// Invalid returns all rules with an invalid feed selector or filter expression
+func (rs *RuleSet) Invalid() []InvalidRule {
+	return rs.invalid
+}
+
+// Checksum changes whenever a rule is added, removed, changed or reordered
+func (rs *RuleSet) Checksum() string {
+	if rs.checksum == "" {
+		return checksum(nil)
+	}
+	return rs.checksum
+}
+
+// Volatile reports whether one of the rules uses an attribute that changes after an entry was fetched, like its age.
+// Entries have to be evaluated again on every run for these rules.
+func (rs *RuleSet) Volatile() bool {
+	return rs.volatile
+}
+
+// Scoped reports whether one of the rules is defined in a category block
+func (rs *RuleSet) Scoped() bool {
+	return rs.scoped
+}
+
+// Resolve returns a copy of the rule set with the category blocks resolved against the categories of the Miniflux
+// user, so a block matches the feeds of its category even if they were added after the killfile was written. The
+// rules of a block with an unknown category don't match any feed, there's an error for every unknown category.
+func (rs *RuleSet) Resolve(categories []*miniflux.Category) (*RuleSet, []error) {
+	if !rs.scoped {
+		return rs, nil
+	}
+	var (
+		errs     []error
+		unknown  = make(map[string]bool)
+		resolved = *rs
+	)
+	resolved.compiled = make([]CompiledRule, len(rs.compiled))
+	for i, rule := range rs.compiled {
+		if rule.Scoped() {
+			rule.categoryID = findCategory(categories, rule.Rule)
+			if rule.categoryID < 0 && !unknown[rule.Scope()] {
+				unknown[rule.Scope()] = true
+				errs = append(errs, fmt.Errorf("unknown %s", rule.Scope()))
+			}
+		}
+		resolved.compiled[i] = rule
+	}
+	return &resolved, errs
+}
+
+// findCategory returns the ID of the category of the rule's block, or -1 if there's no such category
+func findCategory(categories []*miniflux.Category, rule Rule) int64 {
+	for _, c := range categories {
+		if rule.CategoryID != 0 && c.ID == rule.CategoryID || rule.CategoryID == 0 && strings.EqualFold(c.Title, rule.Category) {
+			return c.ID
+		}
+	}
+	return -1
+}
+
+// cache holds the current rule set of a repository, it's swapped atomically so a running filter job keeps using
+// the rule set it started with
+type cache struct {
+	ruleSet atomic.Value
+}
+
+// RuleSet returns the compiled rules from cache
+func (c *cache) RuleSet() *RuleSet {
+	if rs, ok := c.ruleSet.Load().(*RuleSet); ok {
+		return rs
+	}
+	return &RuleSet{}
+}
+
+// Rules returns rules from cache
+func (c *cache) Rules() []Rule {
+	if rules := c.RuleSet().Rules(); rules != nil {
+		return rules
+	}
+	return []Rule{}
+}
+
+// SetCachedRules compiles the rules and replaces the in-memory cache
+func (c *cache) SetCachedRules(rules []Rule) {
+	c.ruleSet.Store(NewRuleSet(rules))
+}
@@ -0,0 +1,99 @@
+package rules
+
+import (
+	"testing"
+
+	miniflux "miniflux.app/client"
+)
+
+func TestChecksum(t *testing.T) {
+	base := []Rule{
+		{Command: CommandIgnoreArticle, URL: "*", FilterExpression: "title = Moon", Source: "killfile", Line: 1},
+		{Command: CommandKeepArticle, URL: "https://example.com", FilterExpression: "author = Bob", Source: "killfile", Line: 2},
+	}
+	tests := []struct {
+		name  string
+		rules []Rule
+		same  bool
+	}{
+		{
+			name: "moved to other lines",
+			rules: []Rule{
+				{Command: CommandIgnoreArticle, URL: "*", FilterExpression: "title = Moon", Source: "other", Line: 10},
+				{Command: CommandKeepArticle, URL: "https://example.com", FilterExpression: "author = Bob", Source: "other", Line: 12},
+			},
+			same: true,
+		},
+		{
+			name: "changed expression",
+			rules: []Rule{
+				{Command: CommandIgnoreArticle, URL: "*", FilterExpression: "title = Sun"},
+				{Command: CommandKeepArticle, URL: "https://example.com", FilterExpression: "author = Bob"},
+			},
+		},
+		{
+			name: "reordered",
+			rules: []Rule{
+				{Command: CommandKeepArticle, URL: "https://example.com", FilterExpression: "author = Bob"},
+				{Command: CommandIgnoreArticle, URL: "*", FilterExpression: "title = Moon"},
+			},
+		},
+		{
+			name:  "removed",
+			rules: base[:1],
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NewRuleSet(tt.rules).Checksum() == NewRuleSet(base).Checksum()
+			if got != tt.same {
+				t.Errorf("same checksum = %v, want %v", got, tt.same)
+			}
+		})
+	}
+	if got, want := (&RuleSet{}).Checksum(), NewRuleSet(nil).Checksum(); got != want {
+		t.Errorf("empty RuleSet.Checksum() = %q, want %q", got, want)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	rs := NewRuleSet([]Rule{
+		{Command: CommandIgnoreArticle, URL: "*", FilterExpression: "title = Moon"},
+		{Command: CommandIgnoreArticle, URL: "*", FilterExpression: "title = Moon", Category: "tech news"},
+		{Command: CommandIgnoreArticle, URL: "*", FilterExpression: "title = Moon", CategoryID: 2},
+		{Command: CommandIgnoreArticle, URL: "*", FilterExpression: "title = Moon", Category: "Science"},
+		{Command: CommandIgnoreArticle, URL: "*", FilterExpression: "title = Sun", Category: "Science"},
+	})
+	resolved, errs := rs.Resolve([]*miniflux.Category{{ID: 1, Title: "Tech News"}, {ID: 2, Title: "Sports"}})
+	if len(errs) != 1 || errs[0].Error() != `unknown category "Science"` {
+		t.Errorf("Resolve() errors = %v, want one unknown category", errs)
+	}
+
+	// The category of the feed is resolved by its ID, even if the feed still has the old title of a renamed category
+	feed := &miniflux.Feed{ID: 1, Category: &miniflux.Category{ID: 1, Title: "Old title"}}
+	tests := []struct {
+		name     string
+		feed     *miniflux.Feed
+		wantRule []bool
+	}{
+		{name: "Feed of a category", feed: feed, wantRule: []bool{true, true, false, false, false}},
+		{name: "Feed of a category by ID", feed: &miniflux.Feed{ID: 2, Category: &miniflux.Category{ID: 2}}, wantRule: []bool{true, false, true, false, false}},
+		{name: "Feed without category", feed: &miniflux.Feed{ID: 3}, wantRule: []bool{true, false, false, false, false}},
+		{name: "Entry without feed", wantRule: []bool{true, false, false, false, false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i, rule := range resolved.Compiled() {
+				if got := rule.MatchesFeed(tt.feed); got != tt.wantRule[i] {
+					t.Errorf("rule %d MatchesFeed() = %v, want %v", i, got, tt.wantRule[i])
+				}
+			}
+		})
+	}
+	if !rs.Compiled()[1].MatchesFeed(&miniflux.Feed{Category: &miniflux.Category{Title: "Tech News"}}) {
+		t.Errorf("MatchesFeed() of an unresolved rule set doesn't match the category by its title")
+	}
+	if resolved.Checksum() != rs.Checksum() {
+		t.Errorf("Resolve() changed the checksum")
+	}
+}
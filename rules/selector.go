@@ -0,0 +1,142 @@
+package rules
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	miniflux "miniflux.app/client"
+)
+
+type selectorKind int
+
+const (
+	selectAll selectorKind = iota
+	selectURL
+	selectHost
+	selectGlob
+	selectRegexp
+	selectID
+	selectTitle
+	selectCategory
+	selectContains
+)
+
+// selectorPrefixes maps the prefixes of the feed selector syntaxes to their kind
+var selectorPrefixes = map[string]selectorKind{
+	"host":     selectHost,
+	"re":       selectRegexp,
+	"id":       selectID,
+	"title":    selectTitle,
+	"category": selectCategory,
+	"contains": selectContains,
+}
+
+// Selector decides which feeds a rule applies to. The feed of a rule can be * for all feeds or
+//
+//	https://example.com/   the feed with exactly this URL
+//	https://*.example.com  all feeds with a URL matching the glob, * matches any characters
+//	host:example.com       all feeds with this host
+//	re:^https?://.*\.com/  all feeds with a URL matching the regular expression
+//	id:42                  the feed with the Miniflux ID 42
+//	title:"Example"        the feed with this title, ignoring case
+//	category:"Tech News"   all feeds of the Miniflux category with this title, ignoring case
+//	contains:example.com   all feeds with a URL containing the text
+//
+// Values can be put in double quotes.
+type Selector struct {
+	raw   string
+	kind  selectorKind
+	value string
+	id    int64
+	re    *regexp.Regexp
+}
+
+// ParseSelector parses the feed selector of a rule
+func ParseSelector(s string) (Selector, error) {
+	sel := Selector{raw: s, kind: selectURL, value: s}
+	if s == "*" {
+		sel.kind = selectAll
+		return sel, nil
+	}
+	if i := strings.IndexByte(s, ':'); i > 0 {
+		if kind, ok := selectorPrefixes[s[:i]]; ok {
+			sel.kind = kind
+			sel.value = unquoteSelector(s[i+1:])
+		}
+	}
+	if sel.value == "" {
+		return Selector{}, fmt.Errorf("empty feed selector %q", s)
+	}
+
+	switch sel.kind {
+	case selectURL:
+		if strings.Contains(sel.value, "*") {
+			sel.kind = selectGlob
+			sel.re = regexp.MustCompile("^" + strings.Replace(regexp.QuoteMeta(sel.value), `\*`, ".*", -1) + "$")
+		}
+	case selectRegexp:
+		re, err := regexp.Compile(sel.value)
+		if err != nil {
+			return Selector{}, fmt.Errorf("invalid feed selector %q: %v", s, err)
+		}
+		sel.re = re
+	case selectID:
+		id, err := strconv.ParseInt(sel.value, 10, 64)
+		if err != nil || id <= 0 {
+			return Selector{}, fmt.Errorf("invalid feed ID %q", sel.value)
+		}
+		sel.id = id
+	case selectHost:
+		sel.value = strings.ToLower(sel.value)
+	}
+	return sel, nil
+}
+
+// unquoteSelector removes the double quotes around a selector value
+func unquoteSelector(s string) string {
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// Matches reports whether the selector matches the feed. Only the wildcard selector matches entries without a feed.
+func (s Selector) Matches(feed *miniflux.Feed) bool {
+	if s.kind == selectAll {
+		return true
+	}
+	if feed == nil {
+		return false
+	}
+	switch s.kind {
+	case selectURL:
+		return feed.FeedURL == s.value
+	case selectHost:
+		u, err := url.Parse(feed.FeedURL)
+		return err == nil && strings.ToLower(u.Hostname()) == s.value
+	case selectGlob, selectRegexp:
+		return s.re.MatchString(feed.FeedURL)
+	case selectID:
+		return feed.ID == s.id
+	case selectTitle:
+		return strings.EqualFold(feed.Title, s.value)
+	case selectCategory:
+		return feed.Category != nil && strings.EqualFold(feed.Category.Title, s.value)
+	case selectContains:
+		return strings.Contains(feed.FeedURL, s.value)
+	}
+	return false
+}
+
+// All reports whether the selector matches all feeds
+func (s Selector) All() bool {
+	return s.kind == selectAll
+}
+
+// String returns the selector as it's written in the killfile
+func (s Selector) String() string {
+	return s.raw
+}
@@ -0,0 +1,85 @@
+package rules
+
+import (
+	"testing"
+
+	miniflux "miniflux.app/client"
+)
+
+func TestParseSelector(t *testing.T) {
+	tests := []struct {
+		name     string
+		selector string
+		wantErr  bool
+	}{
+		{name: "Wildcard", selector: "*"},
+		{name: "URL", selector: "https://example.com/feed.xml"},
+		{name: "Glob", selector: "https://*.example.com/*"},
+		{name: "Host", selector: "host:example.com"},
+		{name: "Regular expression", selector: `re:^https://example\.(com|org)/`},
+		{name: "Invalid regular expression", selector: "re:(", wantErr: true},
+		{name: "Feed ID", selector: "id:42"},
+		{name: "Invalid feed ID", selector: "id:abc", wantErr: true},
+		{name: "Negative feed ID", selector: "id:-1", wantErr: true},
+		{name: "Quoted category", selector: `category:"Tech News"`},
+		{name: "Empty category", selector: `category:""`, wantErr: true},
+		{name: "Empty prefix", selector: "host:", wantErr: true},
+		{name: "Empty", selector: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseSelector(tt.selector)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseSelector(%q) error = %v, wantErr %v", tt.selector, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSelectorMatches(t *testing.T) {
+	feed := &miniflux.Feed{
+		ID:       42,
+		Title:    "Example News",
+		FeedURL:  "https://blog.example.com/feed.xml",
+		Category: &miniflux.Category{ID: 1, Title: "Tech News"},
+	}
+	tests := []struct {
+		name     string
+		selector string
+		feed     *miniflux.Feed
+		want     bool
+	}{
+		{name: "Wildcard", selector: "*", feed: feed, want: true},
+		{name: "Wildcard without feed", selector: "*", want: true},
+		{name: "URL without feed", selector: "https://blog.example.com/feed.xml", want: false},
+		{name: "Exact URL", selector: "https://blog.example.com/feed.xml", feed: feed, want: true},
+		{name: "Part of the URL", selector: "https://blog.example.com", feed: feed, want: false},
+		{name: "Glob", selector: "https://*.example.com/*", feed: feed, want: true},
+		{name: "Glob is anchored", selector: "*.example.com", feed: feed, want: false},
+		{name: "Glob quotes other characters", selector: "https://blog.example.com/feed?xml*", feed: feed, want: false},
+		{name: "Host", selector: "host:Blog.Example.com", feed: feed, want: true},
+		{name: "Other host", selector: "host:example.com", feed: feed, want: false},
+		{name: "Regular expression", selector: `re:\.example\.(com|org)/`, feed: feed, want: true},
+		{name: "Regular expression without match", selector: `re:^http://`, feed: feed, want: false},
+		{name: "Feed ID", selector: "id:42", feed: feed, want: true},
+		{name: "Other feed ID", selector: "id:4", feed: feed, want: false},
+		{name: "Title ignores case", selector: `title:"example news"`, feed: feed, want: true},
+		{name: "Part of the title", selector: "title:Example", feed: feed, want: false},
+		{name: "Category", selector: `category:"Tech News"`, feed: feed, want: true},
+		{name: "Other category", selector: "category:Tech", feed: feed, want: false},
+		{name: "Feed without category", selector: "category:Tech", feed: &miniflux.Feed{ID: 1}, want: false},
+		{name: "Contains", selector: "contains:example.com", feed: feed, want: true},
+		{name: "Contains without match", selector: "contains:example.org", feed: feed, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := ParseSelector(tt.selector)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := s.Matches(tt.feed); got != tt.want {
+				t.Errorf("Selector(%q).Matches() = %v, want %v", tt.selector, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package rules
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/dewey/miniflux-sidekick/expr"
+)
+
+// Source is one of several killfiles that are merged into one rule set
+type Source struct {
+	// Origin tags the rules of the killfile, it's the name of the source or its location if it has no name
+	Origin   string
+	Location string
+}
+
+// sourceName matches the optional name in front of the location of a source
+var sourceName = regexp.MustCompile(`^([A-Za-z0-9_.-]+)=`)
+
+// ParseSources parses a comma separated list of local paths and URLs of killfiles, in the order of their precedence.
+// A location can be prefixed with a name, like community=https://example.com/killfile, to tag its rules with a
+// shorter origin. Every comma separates two sources, a comma within a URL has to be escaped as %2C and local paths
+// can't contain a comma.
+func ParseSources(s string) ([]Source, error) {
+	var (
+		sources []Source
+		seen    = make(map[string]bool)
+	)
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		source := Source{Origin: part, Location: part}
+		if m := sourceName.FindStringSubmatch(part); m != nil {
+			source.Origin = m[1]
+			source.Location = strings.TrimSpace(part[len(m[0]):])
+		}
+		if source.Location == "" {
+			return nil, fmt.Errorf("killfile source %q has no location", part)
+		}
+		if seen[source.Origin] {
+			return nil, fmt.Errorf("killfile source %q is listed more than once", source.Origin)
+		}
+		seen[source.Origin] = true
+		sources = append(sources, source)
+	}
+	if len(sources) == 0 {
+		return nil, fmt.Errorf("no killfile sources in %q", s)
+	}
+	return sources, nil
+}
+
+// Merge merges the rules of several killfiles, in the order of their precedence. A rule that's defined more than once
+// is only kept where it's defined first, in the killfile with the highest precedence. Two rules are the same if they
+// have the same command, category block, feed and filter expression, ignoring the formatting of the expression.
+func Merge(layers ...[]Rule) []Rule {
+	var (
+		merged []Rule
+		seen   = make(map[string]bool)
+	)
+	for _, layer := range layers {
+		for _, rule := range layer {
+			expression := rule.FilterExpression
+			if node, err := expr.Parse(expression); err == nil {
+				expression = node.String()
+			}
+			key := rule.Command + "\x00" + rule.Scope() + "\x00" + rule.URL + "\x00" + expression
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			merged = append(merged, rule)
+		}
+	}
+	return merged
+}
+
+type sourcesRepository struct {
+	killfiles Repository
+	strict    bool
+	cache
+}
+
+// NewSourcesRepository returns a repository that merges several local and remote killfiles into one rule set, the
+// location of its rules is a list of sources as parsed by ParseSources. A strict repository refuses to use the rules
+// if a line of one of the killfiles is invalid.
+func NewSourcesRepository(c *http.Client, strict bool) (Repository, error) {
+	killfiles, err := NewRepository(c, strict)
+	if err != nil {
+		return nil, err
+	}
+	return &sourcesRepository{
+		killfiles: killfiles,
+		strict:    strict,
+	}, nil
+}
+
+// FetchRules fetches all killfiles and merges their rules, every rule is tagged with the origin of its killfile. If
+// one of the killfiles can't be fetched no rules are returned, so a refresh keeps the previous rules of all of them.
+func (r *sourcesRepository) FetchRules(location string) ([]Rule, error) {
+	sources, err := ParseSources(location)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		layers      [][]Rule
+		diagnostics Diagnostics
+	)
+	for _, source := range sources {
+		rules, err := r.killfiles.FetchRules(source.Location)
+		if d, ok := err.(Diagnostics); ok {
+			diagnostics = append(diagnostics, d...)
+		} else if err != nil {
+			return nil, fmt.Errorf("killfile %s: %v", source.Origin, err)
+		}
+		for i := range rules {
+			rules[i].Origin = source.Origin
+		}
+		layers = append(layers, rules)
+	}
+
+	rules := Merge(layers...)
+	if diagnostics != nil {
+		return rules, diagnostics
+	}
+	return rules, nil
+}
+
+// RefreshRules fetches all killfiles again and updates the local cache
+func (r *sourcesRepository) RefreshRules(location string) error {
+	return refresh(r, location, r.strict)
+}
@@ -0,0 +1,110 @@
+package rules
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestParseSources(t *testing.T) {
+	tests := []struct {
+		name    string
+		sources string
+		want    []Source
+		wantErr bool
+	}{
+		{
+			name:    "Locations",
+			sources: "./killfile, https://example.com/killfile?list=ads",
+			want: []Source{
+				{Origin: "./killfile", Location: "./killfile"},
+				{Origin: "https://example.com/killfile?list=ads", Location: "https://example.com/killfile?list=ads"},
+			},
+		},
+		{
+			name:    "Names",
+			sources: "local=./killfile,community=https://example.com/killfile?list=ads",
+			want: []Source{
+				{Origin: "local", Location: "./killfile"},
+				{Origin: "community", Location: "https://example.com/killfile?list=ads"},
+			},
+		},
+		{
+			name:    "Escaped comma",
+			sources: "https://example.com/killfile?lists=ads%2Cpodcasts",
+			want:    []Source{{Origin: "https://example.com/killfile?lists=ads%2Cpodcasts", Location: "https://example.com/killfile?lists=ads%2Cpodcasts"}},
+		},
+		{name: "Empty", sources: " , ", wantErr: true},
+		{name: "Name without location", sources: "local=", wantErr: true},
+		{name: "Listed twice", sources: "./killfile,./killfile", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseSources(tt.sources)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseSources() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseSources() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSourcesRepository(t *testing.T) {
+	local, err := ioutil.TempFile("", "killfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(local.Name())
+	local.WriteString(`keep-article "host:example.com" "author = Bob"
+ignore-article * "title =~ \[Sponsor\]"
+`)
+	local.Close()
+
+	community := `ignore-article * "(title =~ \[Sponsor\])"
+remove-article * "title # Moon"
+ignore-article * "titel # Sun"
+`
+	var fail bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(community))
+	}))
+	defer srv.Close()
+
+	rr, err := NewSourcesRepository(srv.Client(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	location := "local=" + local.Name() + ",community=" + srv.URL
+	err = rr.RefreshRules(location)
+	if diagnostics, ok := err.(Diagnostics); !ok || len(diagnostics) != 1 || diagnostics[0].Source != srv.URL {
+		t.Errorf("RefreshRules() = %v, want a diagnostic for the invalid line of the community killfile", err)
+	}
+
+	// The duplicate sponsor rule of the community killfile is dropped, the local one takes precedence
+	want := []Rule{
+		{Command: CommandKeepArticle, URL: "host:example.com", FilterExpression: "author = Bob", Source: local.Name(), Line: 1, Origin: "local"},
+		{Command: CommandIgnoreArticle, URL: "*", FilterExpression: `title =~ \[Sponsor\]`, Source: local.Name(), Line: 2, Origin: "local"},
+		{Command: CommandRemoveArticle, URL: "*", FilterExpression: "title # Moon", Source: srv.URL, Line: 2, Origin: "community"},
+	}
+	if got := rr.Rules(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Rules() = %+v, want %+v", got, want)
+	}
+
+	// If one of the killfiles can't be fetched the previous rules of all of them are kept
+	fail = true
+	if err := rr.RefreshRules(location); err == nil {
+		t.Errorf("RefreshRules() with an unavailable killfile = nil, want error")
+	}
+	if got := rr.Rules(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Rules() after a failed refresh = %+v, want %+v", got, want)
+	}
+}